@@ -80,13 +80,20 @@ func (s *Server) Handler(
 	logger.Log(logrus.InfoLevel, r.Context(), s.getUser(r), "Handler is triggered")
 
 	// Perform database query
-	err := s.performQuery(w, r, parentSpan)
+	body, err := s.performQuery(w, r, parentSpan)
 	if err != nil {
 		return
 	}
 
 	s.performPostprocessing(r, parentSpan)
-	s.createHttpResponse(&w, http.StatusOK, []byte("Success"), parentSpan)
+
+	// Return the queried names if there are any
+	if body == nil {
+		body = []byte("Success")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	s.createHttpResponse(&w, http.StatusOK, body, parentSpan)
 }
 
 // Performs the database query against the MySQL database
@@ -94,7 +101,10 @@ func (s *Server) performQuery(
 	w http.ResponseWriter,
 	r *http.Request,
 	parentSpan trace.Span,
-) error {
+) (
+	[]byte,
+	error,
+) {
 
 	user := s.getUser(r)
 
@@ -102,7 +112,7 @@ func (s *Server) performQuery(
 	dbOperation, dbStatement, err := s.createDbQuery(r)
 	if err != nil {
 		s.createHttpResponse(&w, http.StatusMethodNotAllowed, []byte("Method not allowed"), parentSpan)
-		return err
+		return nil, err
 	}
 
 	// Create database span
@@ -115,7 +125,7 @@ func (s *Server) performQuery(
 	defer dbSpan.End()
 
 	// Perform query
-	err = s.executeDbQuery(ctx, r, dbStatement)
+	body, err := s.executeDbQuery(ctx, r, dbStatement)
 	if err != nil {
 		msg := "Executing DB query is failed."
 		logger.Log(logrus.ErrorLevel, ctx, user, msg)
@@ -124,7 +134,7 @@ func (s *Server) performQuery(
 		s.addErrorToSpan(dbSpan, msg, err)
 
 		s.createHttpResponse(&w, http.StatusInternalServerError, []byte(err.Error()), parentSpan)
-		return err
+		return nil, err
 	}
 
 	// Create database connection error
@@ -137,10 +147,10 @@ func (s *Server) performQuery(
 		s.addErrorToSpan(dbSpan, msg, err)
 
 		s.createHttpResponse(&w, http.StatusInternalServerError, []byte(msg), parentSpan)
-		return errors.New("database connection lost")
+		return nil, errors.New("database connection lost")
 	}
 
-	return nil
+	return body, nil
 }
 
 // Creates the database query operation and statement
@@ -167,10 +177,20 @@ func (s *Server) createDbQuery(
 		} else {
 			dbStatement = dbOperation + " name FROM " + s.MySql.Opts.Table
 		}
+
+		// Look up only the given name if there is any
+		if r.URL.Query().Has("name") {
+			dbStatement += " WHERE name = ?"
+		}
 		return dbOperation, dbStatement, nil
 	case http.MethodDelete:
 		dbOperation = "DELETE"
 		dbStatement = dbOperation + " FROM " + s.MySql.Opts.Table
+
+		// Delete only the given name if there is any
+		if r.URL.Query().Has("name") {
+			dbStatement += " WHERE name = ?"
+		}
 	default:
 		logger.Log(logrus.ErrorLevel, r.Context(), s.getUser(r), "Method is not allowed.")
 		return "", "", errors.New("method not allowed")
@@ -180,23 +200,34 @@ func (s *Server) createDbQuery(
 	return dbOperation, dbStatement, nil
 }
 
-// Executes the MySQL database statement
+// Executes the MySQL database statement and returns the queried names
+// in JSON for the GET requests. GET & DELETE requests with the name param
+// return or delete only the rows of that name.
 func (s *Server) executeDbQuery(
 	ctx context.Context,
 	r *http.Request,
 	dbStatement string,
-) error {
+) (
+	[]byte,
+	error,
+) {
 
 	user := s.getUser(r)
 	logger.Log(logrus.InfoLevel, ctx, user, "Executing query...")
 
+	// Filter by the name if there is any
+	args := []interface{}{}
+	if r.URL.Query().Has("name") {
+		args = append(args, r.URL.Query().Get("name"))
+	}
+
+	var body []byte
 	switch r.Method {
 	case http.MethodGet:
-		// Perform a query
-		rows, err := s.MySql.Instance.Query(dbStatement)
+		rows, err := s.MySql.Instance.Query(dbStatement, args...)
 		if err != nil {
 			logger.Log(logrus.ErrorLevel, ctx, user, err.Error())
-			return err
+			return nil, err
 		}
 		defer rows.Close()
 
@@ -207,29 +238,29 @@ func (s *Server) executeDbQuery(
 			err = rows.Scan(&name)
 			if err != nil {
 				logger.Log(logrus.ErrorLevel, ctx, user, err.Error())
-				return err
+				return nil, err
 			}
 			names = append(names, name)
 		}
 
-		_, err = json.Marshal(names)
+		body, err = json.Marshal(names)
 		if err != nil {
 			logger.Log(logrus.ErrorLevel, ctx, user, err.Error())
-			return err
+			return nil, err
 		}
 	case http.MethodDelete:
-		_, err := s.MySql.Instance.Exec(dbStatement)
+		_, err := s.MySql.Instance.Exec(dbStatement, args...)
 		if err != nil {
 			logger.Log(logrus.ErrorLevel, ctx, user, err.Error())
-			return err
+			return nil, err
 		}
 	default:
 		logger.Log(logrus.ErrorLevel, ctx, user, "Method is not allowed.")
-		return errors.New("method not allowed")
+		return nil, errors.New("method not allowed")
 	}
 
 	logger.Log(logrus.InfoLevel, ctx, user, "Query is executed.")
-	return nil
+	return body, nil
 }
 
 // Creates a HTTP response
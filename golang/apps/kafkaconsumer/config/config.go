@@ -17,6 +17,29 @@ type KafkaConsumerConfig struct {
 	KafkaTopic         string
 	KafkaGroupId       string
 
+	// Kafka failure handling
+	KafkaMaxAttempts     string
+	KafkaRetryTopics     string
+	KafkaDeadLetterTopic string
+
+	// Kafka batch consumption
+	KafkaBatchSize    string
+	KafkaBatchTimeout string
+
+	// Kafka connection
+	KafkaClientId              string
+	KafkaTlsEnabled            string
+	KafkaTlsCaPath             string
+	KafkaTlsCertPath           string
+	KafkaTlsKeyPath            string
+	KafkaTlsInsecureSkipVerify string
+	KafkaSaslMechanism         string
+	KafkaSaslUsername          string
+	KafkaSaslPassword          string
+
+	// Schema registry
+	SchemaRegistryPath string
+
 	// MySQL
 	MysqlServer   string
 	MysqlUsername string
@@ -38,6 +61,25 @@ func NewConfig() {
 		KafkaTopic:         os.Getenv("KAFKA_TOPIC"),
 		KafkaGroupId:       os.Getenv("KAFKA_CONSUMER_GROUP_ID"),
 
+		KafkaMaxAttempts:     os.Getenv("KAFKA_MAX_ATTEMPTS"),
+		KafkaRetryTopics:     os.Getenv("KAFKA_RETRY_TOPICS"),
+		KafkaDeadLetterTopic: os.Getenv("KAFKA_DEAD_LETTER_TOPIC"),
+
+		KafkaBatchSize:    os.Getenv("KAFKA_BATCH_SIZE"),
+		KafkaBatchTimeout: os.Getenv("KAFKA_BATCH_TIMEOUT"),
+
+		KafkaClientId:              os.Getenv("KAFKA_CLIENT_ID"),
+		KafkaTlsEnabled:            os.Getenv("KAFKA_TLS_ENABLED"),
+		KafkaTlsCaPath:             os.Getenv("KAFKA_TLS_CA_PATH"),
+		KafkaTlsCertPath:           os.Getenv("KAFKA_TLS_CERT_PATH"),
+		KafkaTlsKeyPath:            os.Getenv("KAFKA_TLS_KEY_PATH"),
+		KafkaTlsInsecureSkipVerify: os.Getenv("KAFKA_TLS_INSECURE_SKIP_VERIFY"),
+		KafkaSaslMechanism:         os.Getenv("KAFKA_SASL_MECHANISM"),
+		KafkaSaslUsername:          os.Getenv("KAFKA_SASL_USERNAME"),
+		KafkaSaslPassword:          os.Getenv("KAFKA_SASL_PASSWORD"),
+
+		SchemaRegistryPath: os.Getenv("SCHEMA_REGISTRY_PATH"),
+
 		MysqlServer:   os.Getenv("MYSQL_SERVER"),
 		MysqlUsername: os.Getenv("MYSQL_USERNAME"),
 		MysqlPassword: os.Getenv("MYSQL_PASSWORD"),
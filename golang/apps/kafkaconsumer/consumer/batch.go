@@ -0,0 +1,199 @@
+package consumer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/logger"
+	otelsemconv "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Collects the messages of the claim into batches of up to the batch
+// size. A batch which is not full is processed once the batch timeout
+// after its first message passes. The messages of an unprocessed batch
+// are consumed again by the next session.
+func (g *groupHandler) consumeBatches(
+	session sarama.ConsumerGroupSession,
+	claim sarama.ConsumerGroupClaim,
+) error {
+	batch := make([]*sarama.ConsumerMessage, 0, g.Opts.BatchSize)
+	var timeout <-chan time.Time
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			// The claim is closed when the session ends
+			if !ok {
+				return nil
+			}
+
+			batch = append(batch, msg)
+			if len(batch) == 1 {
+				timeout = time.After(g.Opts.BatchTimeout)
+			}
+			if len(batch) < g.Opts.BatchSize {
+				continue
+			}
+
+		case <-timeout:
+
+		case <-session.Context().Done():
+			return nil
+		}
+
+		if !g.consumeBatch(session, batch) {
+			return nil
+		}
+		batch = make([]*sarama.ConsumerMessage, 0, g.Opts.BatchSize)
+		timeout = nil
+	}
+}
+
+// Stores the messages of the batch into db within a single transaction
+// & acknowledges them once it is committed. The messages which cannot be
+// parsed are consumed one by one in their order after the commit. If the
+// batch fails, all of its messages are consumed one by one so that the
+// retry & dead letter topics apply to them. Returns false if the session
+// ends before every message is handled.
+func (g *groupHandler) consumeBatch(
+	session sarama.ConsumerGroupSession,
+	msgs []*sarama.ConsumerMessage,
+) bool {
+
+	// Create batch process span (parent)
+	ctx := context.Background()
+	ctx, endProcess := g.Consumer.StartBatchProcess(ctx, msgs, g.Opts.ConsumerGroupId)
+
+	// Parse names out of the messages
+	names := make([]string, 0, len(msgs))
+	unparsed := map[*sarama.ConsumerMessage]bool{}
+	for _, msg := range msgs {
+		name, err := g.parseName(ctx, msg)
+		if err != nil {
+			unparsed[msg] = true
+			continue
+		}
+		names = append(names, name)
+	}
+
+	logger.Log(logrus.InfoLevel, ctx, "", "Consuming batch...")
+
+	var err error
+	if len(names) > 0 {
+		err = g.storeBatchIntoDb(ctx, names)
+	}
+	endProcess(err)
+
+	if err != nil {
+		logger.Log(logrus.ErrorLevel, ctx, "", "Consuming batch is failed. Consuming its messages one by one...")
+		for _, msg := range msgs {
+			if !g.consumeMessage(session, msg) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Acknowledge messages after the commit in their order so that no
+	// offset is marked past a message which is not handled
+	for _, msg := range msgs {
+		if unparsed[msg] {
+			if !g.consumeMessage(session, msg) {
+				return false
+			}
+			continue
+		}
+		session.MarkMessage(msg, "")
+	}
+	logger.Log(logrus.InfoLevel, ctx, "", "Consuming batch is succeeded.")
+	return true
+}
+
+// Inserts the names with a single multi-row statement within a transaction
+func (g *groupHandler) storeBatchIntoDb(
+	ctx context.Context,
+	names []string,
+) error {
+
+	logger.Log(logrus.InfoLevel, ctx, "", "Storing batch into DB...")
+
+	// Build db query
+	dbOperation := "INSERT"
+	dbStatement := dbOperation + " INTO " + g.MySql.Opts.Table + " (name) VALUES " +
+		strings.TrimSuffix(strings.Repeat("(?),", len(names)), ",")
+
+	// Get current parentSpan
+	parentSpan := trace.SpanFromContext(ctx)
+
+	// Create db span
+	spanName := dbOperation + " " + g.MySql.Opts.Database + "." + g.MySql.Opts.Table
+	ctx, dbSpan := parentSpan.TracerProvider().
+		Tracer(g.Opts.ServiceName).
+		Start(
+			ctx,
+			spanName,
+			trace.WithSpanKind(trace.SpanKindClient),
+		)
+	defer dbSpan.End()
+
+	// Set additional span attributes
+	dbSpanAttrs := []attribute.KeyValue{
+		semconv.DBSystemMySQL,
+		semconv.DBUser(g.MySql.Opts.Username),
+		semconv.NetPeerName(g.MySql.Opts.Server),
+		semconv.NetTransportTCP,
+		semconv.DBName(g.MySql.Opts.Database),
+		semconv.DBSQLTable(g.MySql.Opts.Table),
+		semconv.DBOperation(dbOperation),
+		semconv.DBStatement(dbStatement),
+		otelsemconv.DbOperationBatchSize.Int(len(names)),
+	}
+
+	// Records the failure on the db span
+	fail := func(msg string, err error) error {
+		logger.Log(logrus.ErrorLevel, ctx, "", msg)
+
+		dbSpanAttrs = append(dbSpanAttrs, semconv.OTelStatusCodeError)
+		dbSpanAttrs = append(dbSpanAttrs, semconv.OTelStatusDescription(msg))
+		dbSpan.SetAttributes(dbSpanAttrs...)
+
+		dbSpan.RecordError(err, trace.WithAttributes(
+			semconv.ExceptionEscaped(true),
+		))
+
+		return err
+	}
+
+	// Begin a transaction
+	tx, err := g.MySql.Instance.BeginTx(ctx, nil)
+	if err != nil {
+		return fail("Beginning DB transaction is failed.", err)
+	}
+
+	// Execute the statement
+	args := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		args = append(args, name)
+	}
+	_, err = tx.ExecContext(ctx, dbStatement, args...)
+	if err != nil {
+		tx.Rollback()
+		return fail("Storing batch into DB is failed.", err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fail("Committing DB transaction is failed.", err)
+	}
+
+	dbSpan.SetAttributes(dbSpanAttrs...)
+	logger.Log(logrus.InfoLevel, ctx, "", "Storing batch into DB is succeeded.")
+	return nil
+}
@@ -2,22 +2,46 @@ package consumer
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/sirupsen/logrus"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/event"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/kafkaconfig"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/logger"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/mysql"
 	otelkafka "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/kafka"
+	otelsemconv "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/semconv/v1.24.0"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// Time to wait before the consumer group rejoins after a failed session
+	consumeRetryBackoff = 5 * time.Second
+
+	// Max time to wait before a message which could not be handled is
+	// handled again
+	maxFailureBackoff = 30 * time.Second
+)
+
 type Opts struct {
 	ServiceName     string
 	BrokerAddress   string
 	BrokerTopic     string
 	ConsumerGroupId string
+	ClientConfig    *kafkaconfig.ClientConfig
+	SchemaRegistry  *event.Registry
+	MaxAttempts     int
+	RetryTopics     []RetryTopic
+	DeadLetterTopic string
+	BatchSize       int
+	BatchTimeout    time.Duration
+	FailureBackoff  time.Duration
 }
 
 type OptFunc func(*Opts)
@@ -27,6 +51,10 @@ func defaultOpts() *Opts {
 		BrokerAddress:   "kafka",
 		BrokerTopic:     "otel",
 		ConsumerGroupId: "kafkaconsumer",
+		MaxAttempts:     3,
+		BatchSize:       1,
+		BatchTimeout:    time.Second,
+		FailureBackoff:  500 * time.Millisecond,
 	}
 }
 
@@ -49,6 +77,13 @@ func New(
 		f(opts)
 	}
 
+	if opts.SchemaRegistry == nil {
+		opts.SchemaRegistry = event.DefaultRegistry()
+	}
+	if opts.ClientConfig == nil {
+		opts.ClientConfig = kafkaconfig.New()
+	}
+
 	return &KafkaConsumer{
 		MySql: db,
 		Opts:  opts,
@@ -83,12 +118,113 @@ func WithConsumerGroupId(groupId string) OptFunc {
 	}
 }
 
+// Configure connection settings (TLS, SASL & client id) of the Kafka client
+func WithClientConfig(config *kafkaconfig.ClientConfig) OptFunc {
+	return func(opts *Opts) {
+		opts.ClientConfig = config
+	}
+}
+
+// Configure registry which the messages are validated against
+func WithSchemaRegistry(registry *event.Registry) OptFunc {
+	return func(opts *Opts) {
+		opts.SchemaRegistry = registry
+	}
+}
+
+// Configure number of times a message is processed on every delivery
+func WithMaxAttempts(maxAttempts string) OptFunc {
+	if maxAttempts == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.Atoi(maxAttempts)
+	if err != nil {
+		panic(err.Error())
+	}
+	if parsed < 1 {
+		panic("max attempts must be at least 1")
+	}
+	return func(opts *Opts) {
+		opts.MaxAttempts = parsed
+	}
+}
+
+// Configure chain of retry topics (e.g. "otel-retry-5s:5s,otel-retry-1m:1m")
+// which the failed messages go through before they are given up
+func WithRetryTopics(retryTopics string) OptFunc {
+	if retryTopics == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := ParseRetryTopics(retryTopics)
+	if err != nil {
+		panic(err.Error())
+	}
+	return func(opts *Opts) {
+		opts.RetryTopics = parsed
+	}
+}
+
+// Configure topic which the messages are published into once they are
+// given up ("" processes them again until they succeed, which blocks
+// their partition)
+func WithDeadLetterTopic(topic string) OptFunc {
+	return func(opts *Opts) {
+		opts.DeadLetterTopic = topic
+	}
+}
+
+// Configure max number of messages of a partition which are stored
+// together ("1" disables batching)
+func WithBatchSize(batchSize string) OptFunc {
+	if batchSize == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.Atoi(batchSize)
+	if err != nil {
+		panic(err.Error())
+	}
+	if parsed < 1 {
+		panic("batch size must be at least 1")
+	}
+	return func(opts *Opts) {
+		opts.BatchSize = parsed
+	}
+}
+
+// Configure max duration in milliseconds to wait for a batch to fill up
+func WithBatchTimeout(batchTimeout string) OptFunc {
+	if batchTimeout == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.ParseInt(batchTimeout, 10, 64)
+	if err != nil {
+		panic(err.Error())
+	}
+	if parsed < 1 {
+		panic("batch timeout must be at least 1")
+	}
+	return func(opts *Opts) {
+		opts.BatchTimeout = time.Duration(parsed) * time.Millisecond
+	}
+}
+
+// Joins the consumer group & consumes the topic until the context is
+// cancelled. Every rebalance ends the session of the group, so the topic
+// is consumed again within a new session until then.
 func (k *KafkaConsumer) StartConsumerGroup(
 	ctx context.Context,
 ) error {
-	saramaConfig := sarama.NewConfig()
-	saramaConfig.Version = sarama.V3_0_0_0
-	saramaConfig.Producer.Return.Successes = true
+	saramaConfig, err := k.Opts.ClientConfig.NewSaramaConfig()
+	if err != nil {
+		return err
+	}
+
+	// Skip the messages of aborted transactions
+	saramaConfig.Consumer.IsolationLevel = sarama.ReadCommitted
+
+	// Report the errors of the group instead of only logging them inside
+	// sarama
+	saramaConfig.Consumer.Return.Errors = true
 
 	consumerGroup, err := sarama.NewConsumerGroup(
 		[]string{k.Opts.BrokerAddress},
@@ -99,36 +235,120 @@ func (k *KafkaConsumer) StartConsumerGroup(
 		return err
 	}
 
+	// The errors channel is closed when the group is closed
+	errorsDrained := make(chan struct{})
+	go func() {
+		defer close(errorsDrained)
+		for err := range consumerGroup.Errors() {
+			logger.Log(logrus.ErrorLevel, ctx, "", "Consumer group error: "+err.Error())
+		}
+	}()
+	defer func() {
+		if err := consumerGroup.Close(); err != nil {
+			logger.Log(logrus.ErrorLevel, ctx, "", "Closing consumer group is failed: "+err.Error())
+		}
+		<-errorsDrained
+		logger.Log(logrus.InfoLevel, ctx, "", "Consumer group is closed.")
+	}()
+
 	otelconsumer := otelkafka.New()
 	handler := groupHandler{
 		Opts:     k.Opts,
 		MySql:    k.MySql,
 		Consumer: otelconsumer,
+		Codec:    event.NewCodec(k.Opts.SchemaRegistry, event.EncodingJson),
 	}
 
-	err = consumerGroup.Consume(
-		ctx,
-		[]string{k.Opts.BrokerTopic},
-		&handler,
-	)
+	// Republish the failed messages into the retry topics & the given up
+	// ones into the dead letter topic
+	if len(k.Opts.RetryTopics) > 0 || k.Opts.DeadLetterTopic != "" {
+		producer, err := k.newProducer()
+		if err != nil {
+			return err
+		}
+		defer producer.Close()
+
+		otelproducer := otelkafka.NewProducer(producer)
+		if len(k.Opts.RetryTopics) > 0 {
+			handler.Retry = newRetry(k.Opts.RetryTopics, k.Opts.ConsumerGroupId, otelproducer)
+		}
+		if k.Opts.DeadLetterTopic != "" {
+			handler.DeadLetter = newDeadLetter(k.Opts.DeadLetterTopic, k.Opts.ConsumerGroupId, otelproducer)
+		}
+	}
+
+	// The retry topics are consumed within the same group
+	topics := []string{k.Opts.BrokerTopic}
+	for _, retryTopic := range k.Opts.RetryTopics {
+		topics = append(topics, retryTopic.Topic)
+	}
+
+	for {
+		err = consumerGroup.Consume(
+			ctx,
+			topics,
+			&handler,
+		)
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// Wait a bit before rejoining after a failure. A session which
+		// ended with a rebalance is started again right away.
+		if err != nil {
+			logger.Log(logrus.ErrorLevel, ctx, "", "Consuming topic is failed: "+err.Error())
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(consumeRetryBackoff):
+			}
+		}
+	}
+}
+
+// Creates the producer of the retry & dead letter topics which waits for
+// all replicas so that no failed message is lost
+func (k *KafkaConsumer) newProducer() (
+	sarama.SyncProducer,
+	error,
+) {
+	saramaConfig, err := k.Opts.ClientConfig.NewSaramaConfig()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	saramaConfig.Producer.Return.Successes = true
 
-	return nil
+	return sarama.NewSyncProducer([]string{k.Opts.BrokerAddress}, saramaConfig)
 }
 
 type groupHandler struct {
-	Opts     *Opts
-	MySql    *mysql.MySqlDatabase
-	Consumer *otelkafka.KafkaConsumer
+	Opts       *Opts
+	MySql      *mysql.MySqlDatabase
+	Consumer   *otelkafka.KafkaConsumer
+	Codec      *event.Codec
+	Retry      *retry
+	DeadLetter *deadLetter
 }
 
-func (g *groupHandler) Setup(_ sarama.ConsumerGroupSession) error {
+// Records the partitions which are assigned to the new session
+func (g *groupHandler) Setup(
+	session sarama.ConsumerGroupSession,
+) error {
+	g.Consumer.Rebalance(session.Context(), session, g.Opts.ConsumerGroupId, otelkafka.RebalanceAssign)
+	logger.Log(logrus.InfoLevel, session.Context(), "", "Partitions are assigned.")
 	return nil
 }
 
-func (g *groupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
+// Records the partitions which are revoked from the ending session
+func (g *groupHandler) Cleanup(
+	session sarama.ConsumerGroupSession,
+) error {
+	g.Consumer.Rebalance(session.Context(), session, g.Opts.ConsumerGroupId, otelkafka.RebalanceRevoke)
+	logger.Log(logrus.InfoLevel, session.Context(), "", "Partitions are revoked.")
 	return nil
 }
 
@@ -136,10 +356,33 @@ func (g *groupHandler) ConsumeClaim(
 	session sarama.ConsumerGroupSession,
 	claim sarama.ConsumerGroupClaim,
 ) error {
+
+	// Only the messages of the topic are batched. The retried ones are
+	// consumed one by one since each of them waits for its own due time.
+	if g.Opts.BatchSize > 1 && claim.Topic() == g.Opts.BrokerTopic {
+		return g.consumeBatches(session, claim)
+	}
+
 	for {
 		select {
-		case msg := <-claim.Messages():
-			g.consumeMessage(session, msg)
+		case msg, ok := <-claim.Messages():
+			// The claim is closed when the session ends
+			if !ok {
+				return nil
+			}
+
+			// Retried messages wait until they are due. Since the messages
+			// of a retry topic have the same delay, the later ones are due
+			// later as well.
+			if !g.waitUntilDue(session.Context(), msg) {
+				return nil
+			}
+
+			// The partition must not move past a message which is not
+			// handled, so the claim ends with the session instead
+			if !g.consumeMessage(session, msg) {
+				return nil
+			}
 
 		case <-session.Context().Done():
 			return nil
@@ -147,10 +390,12 @@ func (g *groupHandler) ConsumeClaim(
 	}
 }
 
+// Consumes the message & acknowledges it once it is handled. Returns false
+// if the session ends before the message is handled.
 func (g *groupHandler) consumeMessage(
 	session sarama.ConsumerGroupSession,
 	msg *sarama.ConsumerMessage,
-) error {
+) bool {
 
 	// Create consumer span (parent)
 	ctx := context.Background()
@@ -158,22 +403,215 @@ func (g *groupHandler) consumeMessage(
 	defer endConsume()
 
 	// Parse name out of the message
-	name := string(msg.Value)
+	name, err := g.parseName(ctx, msg)
+	if err != nil {
+		logger.Log(logrus.ErrorLevel, ctx, "", "Parsing message is failed: "+err.Error())
+
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(otelsemconv.ErrorType.String(event.ErrorType(err)))
+		span.SetStatus(codes.Error, err.Error())
+
+		// Give the message up right away since it would never be parsed.
+		// Without a dead letter topic, it is skipped.
+		if g.DeadLetter == nil {
+			session.MarkMessage(msg, "")
+			return true
+		}
+		return g.publishDeadLetter(ctx, session, msg, 1, event.ErrorType(err), err, span.SpanContext())
+	}
 
 	logger.Log(logrus.InfoLevel, ctx, name, "Consuming message...")
 
-	// Store it into db
-	err := g.storeIntoDb(ctx, name)
-	if err != nil {
+	// Store it into db until it succeeds or the attempts of the delivery
+	// run out. Every attempt links to the previous failed one, even to the
+	// one of the previous delivery.
+	delivery := deliveryOf(msg)
+	failed := previousOf(msg)
+	attempt := (delivery - 1) * g.Opts.MaxAttempts
+	for round := 0; ; round++ {
+		for i := 1; i <= g.Opts.MaxAttempts; i++ {
+			attempt++
+			processCtx, endProcess := g.Consumer.StartProcess(ctx, msg, g.Opts.ConsumerGroupId, attempt, failed)
+			err = g.storeIntoDb(processCtx, name)
+			endProcess(err)
+			if err == nil {
+				break
+			}
+			failed = trace.SpanFromContext(processCtx).SpanContext()
+			logger.Log(logrus.WarnLevel, ctx, name, "Attempt "+strconv.Itoa(attempt)+" of consuming message is failed.")
+		}
+		if err == nil {
+			break
+		}
+
 		logger.Log(logrus.ErrorLevel, ctx, name, "Consuming message is failed.")
-		return nil
+		if (g.Retry != nil && g.Retry.hasNext(delivery)) || g.DeadLetter != nil {
+			return g.handleFailure(ctx, session, msg, delivery, dbErrorType(err), err, failed)
+		}
+
+		// Without retry & dead letter topics, the message is processed
+		// again until it succeeds
+		if !g.waitFailureBackoff(session.Context(), round) {
+			return false
+		}
 	}
 
 	// Acknowledge message
 	session.MarkMessage(msg, "")
 	logger.Log(logrus.InfoLevel, ctx, name, "Consuming message is succeeded.")
 
-	return nil
+	return true
+}
+
+// Publishes the failed message into the retry topic of its next delivery
+// or into the dead letter topic once the retry topics run out. The message
+// is acknowledged once it is published. Returns false if the session ends
+// before the message is published.
+func (g *groupHandler) handleFailure(
+	ctx context.Context,
+	session sarama.ConsumerGroupSession,
+	msg *sarama.ConsumerMessage,
+	delivery int,
+	errorType string,
+	cause error,
+	failed trace.SpanContext,
+) bool {
+	if g.Retry != nil && g.Retry.hasNext(delivery) {
+		published := g.retryUntilSessionEnds(session.Context(), func() error {
+			err := g.Retry.publish(ctx, msg, delivery, errorType, cause, failed)
+			if err != nil {
+				logger.Log(logrus.ErrorLevel, ctx, "", "Publishing message into retry topic is failed: "+err.Error())
+			}
+			return err
+		})
+		if !published {
+			return false
+		}
+
+		session.MarkMessage(msg, "")
+		logger.Log(logrus.InfoLevel, ctx, "", "Message is published into retry topic.")
+		return true
+	}
+
+	return g.publishDeadLetter(ctx, session, msg, delivery*g.Opts.MaxAttempts, errorType, cause, failed)
+}
+
+// Publishes the message which could not be processed into the dead
+// letter topic & acknowledges it once it is published. The publish is
+// retried until it succeeds. Returns false if the session ends before.
+func (g *groupHandler) publishDeadLetter(
+	ctx context.Context,
+	session sarama.ConsumerGroupSession,
+	msg *sarama.ConsumerMessage,
+	attempts int,
+	errorType string,
+	cause error,
+	failed trace.SpanContext,
+) bool {
+	published := g.retryUntilSessionEnds(session.Context(), func() error {
+		err := g.DeadLetter.publish(ctx, msg, attempts, errorType, cause, failed)
+		if err != nil {
+			logger.Log(logrus.ErrorLevel, ctx, "", "Publishing message into dead letter topic is failed: "+err.Error())
+		}
+		return err
+	})
+	if !published {
+		return false
+	}
+
+	session.MarkMessage(msg, "")
+	logger.Log(logrus.InfoLevel, ctx, "", "Message is published into dead letter topic.")
+	return true
+}
+
+// Runs the operation until it succeeds with a growing backoff in between.
+// Returns false if the session ends before.
+func (g *groupHandler) retryUntilSessionEnds(
+	ctx context.Context,
+	operation func() error,
+) bool {
+	for round := 0; ; round++ {
+		if operation() == nil {
+			return true
+		}
+		if !g.waitFailureBackoff(ctx, round) {
+			return false
+		}
+	}
+}
+
+// Waits for the backoff of the given round of handling a failure which
+// doubles with every round. Returns false if the session ends before.
+func (g *groupHandler) waitFailureBackoff(
+	ctx context.Context,
+	round int,
+) bool {
+	backoff := g.Opts.FailureBackoff
+	for i := 0; i < round && backoff < maxFailureBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxFailureBackoff {
+		backoff = maxFailureBackoff
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Waits until the retried message is due. Returns false if the session
+// ends in the meantime so that the message is consumed again by the next
+// session.
+func (g *groupHandler) waitUntilDue(
+	ctx context.Context,
+	msg *sarama.ConsumerMessage,
+) bool {
+	due, ok := dueOf(msg)
+	if !ok {
+		return true
+	}
+
+	wait := time.Until(due)
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Decodes the event of the message & returns the name in its payload.
+// Messages without content type are bare names of older producers.
+func (g *groupHandler) parseName(
+	ctx context.Context,
+	msg *sarama.ConsumerMessage,
+) (
+	string,
+	error,
+) {
+	contentType := headerOf(msg, event.ContentTypeHeader)
+	if contentType == "" {
+		return string(msg.Value), nil
+	}
+
+	envelope, err := g.Codec.Decode(ctx, msg.Value, contentType)
+	if err != nil {
+		return "", err
+	}
+	return envelope.Payload["name"], nil
 }
 
 func (g *groupHandler) storeIntoDb(
@@ -189,7 +627,6 @@ func (g *groupHandler) storeIntoDb(
 
 	// Get current parentSpan
 	parentSpan := trace.SpanFromContext(ctx)
-	defer parentSpan.End()
 
 	// Create db span
 	spanName := dbOperation + " " + g.MySql.Opts.Database + "." + g.MySql.Opts.Table
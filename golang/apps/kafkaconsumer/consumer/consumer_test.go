@@ -0,0 +1,733 @@
+package consumer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/event"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/mysql"
+	otelkafka "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/kafka"
+	otelsemconv "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeSession struct {
+	ctx    context.Context
+	claims map[string][]int32
+	marked []*sarama.ConsumerMessage
+}
+
+func (s *fakeSession) Claims() map[string][]int32               { return s.claims }
+func (s *fakeSession) MemberID() string                         { return "member-1" }
+func (s *fakeSession) GenerationID() int32                      { return 7 }
+func (s *fakeSession) MarkOffset(string, int32, int64, string)  {}
+func (s *fakeSession) Commit()                                  {}
+func (s *fakeSession) ResetOffset(string, int32, int64, string) {}
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg)
+}
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "otel" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// Database which fails the given number of executions before it
+// succeeds & records the arguments of the successful ones
+type fakeDb struct {
+	mu       sync.Mutex
+	failures int
+	inserted [][]driver.Value
+}
+
+type fakeDriver struct{}
+
+type fakeConn struct{ db *fakeDb }
+
+type fakeStmt struct{ db *fakeDb }
+
+type fakeTx struct{}
+
+var (
+	fakeDbs   = map[string]*fakeDb{}
+	fakeDbsMu sync.Mutex
+)
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDbsMu.Lock()
+	defer fakeDbsMu.Unlock()
+	return &fakeConn{db: fakeDbs[name]}, nil
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return &fakeStmt{db: c.db}, nil }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if s.db.failures > 0 {
+		s.db.failures--
+		return nil, &mysqldriver.MySQLError{Number: 1146, Message: "Table 'otel.names' doesn't exist"}
+	}
+	s.db.inserted = append(s.db.inserted, args)
+	return driver.RowsAffected(1), nil
+}
+
+func newFakeDb(
+	t *testing.T,
+	failures int,
+) (
+	*mysql.MySqlDatabase,
+	*fakeDb,
+) {
+	db := &fakeDb{failures: failures}
+	fakeDbsMu.Lock()
+	fakeDbs[t.Name()] = db
+	fakeDbsMu.Unlock()
+
+	instance, err := sql.Open("fakedb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { instance.Close() })
+
+	return &mysql.MySqlDatabase{Opts: &mysql.Opts{Database: "otel", Table: "names"}, Instance: instance}, db
+}
+
+func newGroupHandler() *groupHandler {
+	return &groupHandler{
+		Opts:     defaultOpts(),
+		Consumer: otelkafka.New(),
+		Codec:    event.NewCodec(event.DefaultRegistry(), event.EncodingJson),
+	}
+}
+
+// Returns a handler which publishes the given up messages into the
+// mocked dead letter topic
+func newDeadLetterGroupHandler(
+	t *testing.T,
+	db *mysql.MySqlDatabase,
+) (
+	*groupHandler,
+	*mocks.SyncProducer,
+) {
+	producer := mocks.NewSyncProducer(t, nil)
+	t.Cleanup(func() { producer.Close() })
+
+	handler := newGroupHandler()
+	handler.MySql = db
+	handler.DeadLetter = newDeadLetter("otel-dlq", handler.Opts.ConsumerGroupId, otelkafka.NewProducer(producer))
+	return handler, producer
+}
+
+// Records the spans in memory & restores the global tracer provider
+// after the test
+func newSpanRecorder(
+	t *testing.T,
+) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		tp.Shutdown(context.Background())
+	})
+	return sr
+}
+
+// Propagates the trace context in the headers & restores the global
+// propagator after the test
+func useTraceContext(
+	t *testing.T,
+) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTextMapPropagator(previous)
+	})
+}
+
+func header(
+	headers []sarama.RecordHeader,
+	key string,
+) string {
+	for _, h := range headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func Test_ClosedClaimEndsConsumption(t *testing.T) {
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage)}
+	close(claim.messages)
+
+	done := make(chan error)
+	go func() {
+		done <- newGroupHandler().ConsumeClaim(session, claim)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Consuming a closed claim should end.")
+	}
+}
+
+func Test_RebalanceRecorded(t *testing.T) {
+	sr := newSpanRecorder(t)
+
+	session := &fakeSession{
+		ctx: context.Background(),
+		claims: map[string][]int32{
+			"otel":     {2, 0},
+			"retry-5s": {1},
+		},
+	}
+
+	handler := newGroupHandler()
+	if err := handler.Setup(session); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.Cleanup(session); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 2 || spans[0].Name() != "kafkaconsumer assign" || spans[1].Name() != "kafkaconsumer revoke" {
+		t.Fatalf("Expected assign & revoke spans, got %d.", len(spans))
+	}
+
+	assign := spans[0]
+	events := assign.Events()
+	if len(events) != 2 || events[0].Name != "partitions assigned" {
+		t.Fatalf("Expected an event per topic, got %v.", events)
+	}
+	for _, attr := range events[0].Attributes {
+		if attr.Key == otelsemconv.MessagingKafkaDestinationPartitions {
+			partitions := attr.Value.AsInt64Slice()
+			if len(partitions) != 2 || partitions[0] != 0 || partitions[1] != 2 {
+				t.Errorf("Unexpected partitions %v.", partitions)
+			}
+		}
+	}
+	for _, attr := range assign.Attributes() {
+		if attr.Key == otelsemconv.MessagingKafkaPartitionCount && attr.Value.AsInt64() != 3 {
+			t.Errorf("Expected 3 partitions, got %d.", attr.Value.AsInt64())
+		}
+	}
+	if spans[1].Events()[0].Name != "partitions revoked" {
+		t.Error("Expected revoked partitions on cleanup.")
+	}
+}
+
+func Test_FailedMessageRetriedThenDeadLettered(t *testing.T) {
+	sr := newSpanRecorder(t)
+	useTraceContext(t)
+
+	db, _ := newFakeDb(t, 3)
+	handler, producer := newDeadLetterGroupHandler(t, db)
+
+	var published *sarama.ProducerMessage
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		published = msg
+		return nil
+	})
+
+	// Message which carries the trace context of its producer
+	traceparent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	msg := &sarama.ConsumerMessage{
+		Topic:     "otel",
+		Partition: 2,
+		Offset:    42,
+		Value:     []byte("elon"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("traceparent"), Value: []byte(traceparent)},
+		},
+	}
+	session := &fakeSession{ctx: context.Background()}
+	handler.consumeMessage(session, msg)
+
+	if len(session.marked) != 1 {
+		t.Fatal("Dead lettered message should be acknowledged.")
+	}
+	if published.Topic != "otel-dlq" {
+		t.Fatalf("Expected dead letter topic, got %s.", published.Topic)
+	}
+	if header(published.Headers, DeadLetterErrorTypeHeader) != "1146" ||
+		header(published.Headers, DeadLetterAttemptsHeader) != "3" ||
+		header(published.Headers, DeadLetterTopicHeader) != "otel" ||
+		header(published.Headers, DeadLetterPartitionHeader) != "2" ||
+		header(published.Headers, DeadLetterOffsetHeader) != "42" {
+		t.Errorf("Unexpected headers %v.", published.Headers)
+	}
+
+	// The trace of the message is continued by the dead letter publish
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range sr.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	if len(spans["otel process"]) != 3 {
+		t.Fatalf("Expected a span per attempt, got %d.", len(spans["otel process"]))
+	}
+	publish := spans["otel-dlq publish"]
+	if len(publish) != 1 {
+		t.Fatal("Expected dead letter publish span.")
+	}
+	if publish[0].SpanContext().TraceID().String() != "0af7651916cd43dd8448eb211c80319c" {
+		t.Error("Dead letter publish should continue the trace of the message.")
+	}
+	injected := header(published.Headers, "traceparent")
+	if injected == traceparent || injected != "00-"+publish[0].SpanContext().TraceID().String()+"-"+publish[0].SpanContext().SpanID().String()+"-01" {
+		t.Errorf("Expected the context of the publish span, got %s.", injected)
+	}
+
+	// The dead letter publish links to the last failed attempt
+	lastAttempt := spans["otel process"][2]
+	links := publish[0].Links()
+	if len(links) != 1 || links[0].SpanContext.SpanID() != lastAttempt.SpanContext().SpanID() {
+		t.Error("Dead letter publish should link to the last failed attempt.")
+	}
+	for _, attr := range lastAttempt.Attributes() {
+		if attr.Key == otelsemconv.MessagingKafkaConsumerAttempt && attr.Value.AsInt64() != 3 {
+			t.Errorf("Expected attempt 3, got %d.", attr.Value.AsInt64())
+		}
+	}
+}
+
+func Test_RetriedMessageSucceeds(t *testing.T) {
+	db, fake := newFakeDb(t, 1)
+	handler, _ := newDeadLetterGroupHandler(t, db)
+
+	session := &fakeSession{ctx: context.Background()}
+	handler.consumeMessage(session, &sarama.ConsumerMessage{Topic: "otel", Value: []byte("elon")})
+
+	if len(session.marked) != 1 || len(fake.inserted) != 1 || fake.inserted[0][0] != "elon" {
+		t.Error("Message should be stored on the second attempt.")
+	}
+}
+
+func Test_UnparseableMessageDeadLetteredRightAway(t *testing.T) {
+	db, fake := newFakeDb(t, 0)
+	handler, producer := newDeadLetterGroupHandler(t, db)
+
+	var published *sarama.ProducerMessage
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		published = msg
+		return nil
+	})
+
+	session := &fakeSession{ctx: context.Background()}
+	handler.consumeMessage(session, &sarama.ConsumerMessage{
+		Topic: "otel",
+		Value: []byte("{"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(event.ContentTypeHeader), Value: []byte(event.ContentTypeJson)},
+		},
+	})
+
+	if len(fake.inserted) != 0 || len(session.marked) != 1 {
+		t.Fatal("Unparseable message should be given up without processing.")
+	}
+	if header(published.Headers, DeadLetterErrorTypeHeader) != "malformed" ||
+		header(published.Headers, DeadLetterAttemptsHeader) != strconv.Itoa(1) {
+		t.Errorf("Unexpected headers %v.", published.Headers)
+	}
+}
+
+func Test_FailedMessageBlocksPartitionWithoutDeadLetterTopic(t *testing.T) {
+	db, fake := newFakeDb(t, 4)
+	handler := newGroupHandler()
+	handler.MySql = db
+	handler.Opts.FailureBackoff = time.Millisecond
+
+	// The message is processed again until it succeeds
+	session := &fakeSession{ctx: context.Background()}
+	if !handler.consumeMessage(session, &sarama.ConsumerMessage{Topic: "otel", Value: []byte("elon")}) {
+		t.Fatal("Message should be handled.")
+	}
+	if len(fake.inserted) != 1 || len(session.marked) != 1 {
+		t.Error("Message should be stored & acknowledged once it succeeds.")
+	}
+
+	// Unless the session ends before
+	db, _ = newFakeDb(t, 100)
+	handler.MySql = db
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	session = &fakeSession{ctx: ctx}
+	if handler.consumeMessage(session, &sarama.ConsumerMessage{Topic: "otel", Value: []byte("elon")}) {
+		t.Error("Message should not be handled once the session ends.")
+	}
+	if len(session.marked) != 0 {
+		t.Error("Failed message should not be acknowledged.")
+	}
+}
+
+func Test_FailedDeadLetterPublishRetried(t *testing.T) {
+	db, _ := newFakeDb(t, 3)
+	handler, producer := newDeadLetterGroupHandler(t, db)
+	handler.Opts.FailureBackoff = time.Millisecond
+
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	producer.ExpectSendMessageAndSucceed()
+
+	session := &fakeSession{ctx: context.Background()}
+	if !handler.consumeMessage(session, &sarama.ConsumerMessage{Topic: "otel", Value: []byte("elon")}) ||
+		len(session.marked) != 1 {
+		t.Fatal("Message should be acknowledged once it is dead lettered.")
+	}
+
+	// The message is not acknowledged if the session ends before
+	db, _ = newFakeDb(t, 3)
+	handler.MySql = db
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	session = &fakeSession{ctx: ctx}
+	if handler.consumeMessage(session, &sarama.ConsumerMessage{Topic: "otel", Value: []byte("elon")}) ||
+		len(session.marked) != 0 {
+		t.Error("Message should not be acknowledged unless it is dead lettered.")
+	}
+}
+
+func Test_RetryTopicsParsed(t *testing.T) {
+	retryTopics, err := ParseRetryTopics("otel-retry-5s:5s, otel-retry-1m:1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retryTopics) != 2 ||
+		retryTopics[0] != (RetryTopic{Topic: "otel-retry-5s", Delay: 5 * time.Second}) ||
+		retryTopics[1] != (RetryTopic{Topic: "otel-retry-1m", Delay: time.Minute}) {
+		t.Errorf("Unexpected retry topics %v.", retryTopics)
+	}
+
+	for _, invalid := range []string{"otel-retry", ":5s", "otel-retry:soon"} {
+		if _, err := ParseRetryTopics(invalid); err == nil {
+			t.Errorf("Retry topics %q should be rejected.", invalid)
+		}
+	}
+}
+
+func Test_FailedMessageGoesThroughRetryTopics(t *testing.T) {
+	sr := newSpanRecorder(t)
+	useTraceContext(t)
+
+	db, fake := newFakeDb(t, 2)
+	handler, producer := newDeadLetterGroupHandler(t, db)
+	handler.Opts.MaxAttempts = 1
+	handler.Retry = newRetry([]RetryTopic{
+		{Topic: "otel-retry-5s", Delay: 5 * time.Second},
+		{Topic: "otel-retry-1m", Delay: time.Minute},
+	}, handler.Opts.ConsumerGroupId, handler.DeadLetter.producer)
+
+	published := []*sarama.ProducerMessage{}
+	for i := 0; i < 2; i++ {
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			published = append(published, msg)
+			return nil
+		})
+	}
+
+	// Consumes the message as the broker would deliver it
+	deliver := func(msg *sarama.ProducerMessage) *sarama.ConsumerMessage {
+		headers := []*sarama.RecordHeader{}
+		for i := range msg.Headers {
+			headers = append(headers, &msg.Headers[i])
+		}
+		value, _ := msg.Value.Encode()
+		return &sarama.ConsumerMessage{Topic: msg.Topic, Value: value, Headers: headers}
+	}
+
+	session := &fakeSession{ctx: context.Background()}
+	before := time.Now()
+	handler.consumeMessage(session, &sarama.ConsumerMessage{Topic: "otel", Value: []byte("elon")})
+	if len(published) != 1 || published[0].Topic != "otel-retry-5s" {
+		t.Fatal("Failed message should go into the first retry topic.")
+	}
+
+	first := deliver(published[0])
+	if deliveryOf(first) != 2 || originalTopic(first) != "otel" {
+		t.Errorf("Unexpected retry headers %v.", published[0].Headers)
+	}
+	due, ok := dueOf(first)
+	if !ok || due.Before(before.Add(5*time.Second).Truncate(time.Millisecond)) {
+		t.Errorf("Retried message should be due after the delay, got %v.", due)
+	}
+
+	handler.consumeMessage(session, first)
+	if len(published) != 2 || published[1].Topic != "otel-retry-1m" {
+		t.Fatal("Failed retry should go into the next retry topic.")
+	}
+	second := deliver(published[1])
+	if deliveryOf(second) != 3 || originalTopic(second) != "otel" {
+		t.Errorf("Unexpected retry headers %v.", published[1].Headers)
+	}
+	retryHeaders := 0
+	for _, h := range published[1].Headers {
+		if string(h.Key) == RetryAttemptHeader {
+			retryHeaders++
+		}
+	}
+	if retryHeaders != 1 {
+		t.Error("Retry headers should be replaced instead of added again.")
+	}
+
+	handler.consumeMessage(session, second)
+	if len(fake.inserted) != 1 || len(session.marked) != 3 {
+		t.Fatal("Message should be stored on the third delivery.")
+	}
+
+	// Every attempt links to the previous one within the same trace
+	attempts := []sdktrace.ReadOnlySpan{}
+	for _, span := range sr.Ended() {
+		if span.Name() == "otel process" || span.Name() == "otel-retry-5s process" || span.Name() == "otel-retry-1m process" {
+			attempts = append(attempts, span)
+		}
+	}
+	if len(attempts) != 3 {
+		t.Fatalf("Expected 3 attempts, got %d.", len(attempts))
+	}
+	if len(attempts[0].Links()) != 0 {
+		t.Error("First attempt should not link to any other.")
+	}
+	for i := 1; i < len(attempts); i++ {
+		links := attempts[i].Links()
+		if len(links) != 1 || links[0].SpanContext.SpanID() != attempts[i-1].SpanContext().SpanID() {
+			t.Errorf("Attempt %d should link to the previous one.", i+1)
+		}
+		if attempts[i].SpanContext().TraceID() != attempts[0].SpanContext().TraceID() {
+			t.Errorf("Attempt %d should continue the trace of the message.", i+1)
+		}
+	}
+}
+
+func Test_RetriedMessageWaitsUntilDue(t *testing.T) {
+	handler := newGroupHandler()
+	msg := &sarama.ConsumerMessage{
+		Topic: "otel-retry-5s",
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(RetryDueHeader), Value: []byte(strconv.FormatInt(time.Now().Add(50*time.Millisecond).UnixMilli(), 10))},
+		},
+	}
+
+	start := time.Now()
+	if !handler.waitUntilDue(context.Background(), msg) || time.Since(start) < 40*time.Millisecond {
+		t.Error("Retried message should wait until it is due.")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	msg.Headers[0].Value = []byte(strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10))
+	if handler.waitUntilDue(ctx, msg) {
+		t.Error("Waiting should end with the session.")
+	}
+}
+
+func Test_BatchStoredWithSingleInsert(t *testing.T) {
+	sr := newSpanRecorder(t)
+	useTraceContext(t)
+
+	db, fake := newFakeDb(t, 0)
+	handler := newGroupHandler()
+	handler.MySql = db
+	handler.Opts.BatchSize = 3
+
+	traceparents := []string{
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-1af7651916cd43dd8448eb211c80319c-c7ad6b7169203331-01",
+		"00-2af7651916cd43dd8448eb211c80319c-d7ad6b7169203331-01",
+	}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(traceparents))}
+	for i, traceparent := range traceparents {
+		claim.messages <- &sarama.ConsumerMessage{
+			Topic:  "otel",
+			Offset: int64(i),
+			Value:  []byte("user-" + strconv.Itoa(i)),
+			Headers: []*sarama.RecordHeader{
+				{Key: []byte("traceparent"), Value: []byte(traceparent)},
+			},
+		}
+	}
+	close(claim.messages)
+
+	session := &fakeSession{ctx: context.Background()}
+	if err := handler.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.inserted) != 1 || len(fake.inserted[0]) != 3 {
+		t.Fatalf("Expected a single insert of 3 rows, got %v.", fake.inserted)
+	}
+	if len(session.marked) != 3 {
+		t.Errorf("Expected 3 acknowledged messages, got %d.", len(session.marked))
+	}
+
+	// The batch process span links to the producer of every message
+	var batch sdktrace.ReadOnlySpan
+	for _, span := range sr.Ended() {
+		if span.Name() == "otel process" {
+			batch = span
+		}
+	}
+	if batch == nil {
+		t.Fatal("Expected batch process span.")
+	}
+	links := batch.Links()
+	if len(links) != 3 {
+		t.Fatalf("Expected 3 links, got %d.", len(links))
+	}
+	for i, link := range links {
+		if link.SpanContext.TraceID().String() != traceparents[i][3:35] {
+			t.Errorf("Link %d should point to the producer of the message.", i)
+		}
+	}
+}
+
+func Test_PartialBatchStoredAfterTimeout(t *testing.T) {
+	db, fake := newFakeDb(t, 0)
+	handler := newGroupHandler()
+	handler.MySql = db
+	handler.Opts.BatchSize = 10
+	handler.Opts.BatchTimeout = 20 * time.Millisecond
+
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "otel", Value: []byte("elon")}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "otel", Value: []byte("jeff")}
+
+	session := &fakeSession{ctx: context.Background()}
+	done := make(chan error)
+	go func() {
+		done <- handler.ConsumeClaim(session, claim)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	close(claim.messages)
+	<-done
+
+	if len(fake.inserted) != 1 || len(fake.inserted[0]) != 2 || len(session.marked) != 2 {
+		t.Errorf("Partial batch should be stored after the timeout, got %v.", fake.inserted)
+	}
+}
+
+func Test_FailedBatchConsumedOneByOne(t *testing.T) {
+	db, fake := newFakeDb(t, 1)
+	handler := newGroupHandler()
+	handler.MySql = db
+
+	session := &fakeSession{ctx: context.Background()}
+	handler.consumeBatch(session, []*sarama.ConsumerMessage{
+		{Topic: "otel", Offset: 0, Value: []byte("elon")},
+		{Topic: "otel", Offset: 1, Value: []byte("jeff")},
+	})
+
+	if len(fake.inserted) != 2 || len(fake.inserted[0]) != 1 || len(session.marked) != 2 {
+		t.Errorf("Messages of the failed batch should be stored one by one, got %v.", fake.inserted)
+	}
+}
+
+func Test_BatchNotAcknowledgedPastUnparseableMessage(t *testing.T) {
+	db, fake := newFakeDb(t, 0)
+	handler, producer := newDeadLetterGroupHandler(t, db)
+	handler.Opts.FailureBackoff = time.Millisecond
+
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+
+	// The session ends before the unparseable message is dead lettered
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	session := &fakeSession{ctx: ctx}
+	handled := handler.consumeBatch(session, []*sarama.ConsumerMessage{
+		{Topic: "otel", Offset: 0, Value: []byte("elon")},
+		{Topic: "otel", Offset: 1, Value: []byte("{"), Headers: []*sarama.RecordHeader{
+			{Key: []byte(event.ContentTypeHeader), Value: []byte(event.ContentTypeJson)},
+		}},
+		{Topic: "otel", Offset: 2, Value: []byte("jeff")},
+	})
+
+	if handled {
+		t.Error("Batch should not be handled once the session ends.")
+	}
+	if len(fake.inserted) != 1 || len(fake.inserted[0]) != 2 {
+		t.Errorf("Parsed messages should be stored with a single insert, got %v.", fake.inserted)
+	}
+	if len(session.marked) != 1 || session.marked[0].Offset != 0 {
+		t.Errorf("Only the messages before the unparseable one should be acknowledged, got %v.", session.marked)
+	}
+}
+
+func Test_FailedRetryPublishRetried(t *testing.T) {
+	db, _ := newFakeDb(t, 1)
+	handler, producer := newDeadLetterGroupHandler(t, db)
+	handler.Opts.MaxAttempts = 1
+	handler.Opts.FailureBackoff = time.Millisecond
+	handler.Retry = newRetry([]RetryTopic{
+		{Topic: "otel-retry-5s", Delay: 5 * time.Second},
+	}, handler.Opts.ConsumerGroupId, handler.DeadLetter.producer)
+
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != "otel-retry-5s" {
+			return errors.New("expected retry topic, got " + msg.Topic)
+		}
+		return nil
+	})
+
+	session := &fakeSession{ctx: context.Background()}
+	if !handler.consumeMessage(session, &sarama.ConsumerMessage{Topic: "otel", Value: []byte("elon")}) ||
+		len(session.marked) != 1 {
+		t.Fatal("Message should be acknowledged once it is published into the retry topic.")
+	}
+
+	// The message is not acknowledged if the session ends before
+	db, _ = newFakeDb(t, 1)
+	handler.MySql = db
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	session = &fakeSession{ctx: ctx}
+	if handler.consumeMessage(session, &sarama.ConsumerMessage{Topic: "otel", Value: []byte("elon")}) ||
+		len(session.marked) != 0 {
+		t.Error("Message should not be acknowledged unless it is published into the retry topic.")
+	}
+}
@@ -0,0 +1,127 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/IBM/sarama"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	otelkafka "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/kafka"
+	otelsemconv "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers which the dead lettered messages carry in addition to their
+// original ones
+const (
+	DeadLetterErrorTypeHeader     = "dlq.error.type"
+	DeadLetterErrorMessageHeader  = "dlq.error.message"
+	DeadLetterAttemptsHeader      = "dlq.attempts"
+	DeadLetterTopicHeader         = "dlq.original.topic"
+	DeadLetterPartitionHeader     = "dlq.original.partition"
+	DeadLetterOffsetHeader        = "dlq.original.offset"
+	DeadLetterConsumerGroupHeader = "dlq.consumer.group"
+)
+
+// Publishes the messages which could not be processed into the dead
+// letter topic
+type deadLetter struct {
+	topic         string
+	consumerGroup string
+
+	producer *otelkafka.KafkaProducer
+	counter  metric.Int64Counter
+}
+
+func newDeadLetter(
+	topic string,
+	consumerGroup string,
+	producer *otelkafka.KafkaProducer,
+) *deadLetter {
+
+	// Create dead letter counter
+	meter := otel.GetMeterProvider().Meter(otelsemconv.KafkaConsumerName)
+	counter, err := meter.Int64Counter(
+		otelsemconv.MessagingConsumerDeadLettersName,
+		metric.WithUnit("{message}"),
+		metric.WithDescription("Number of messages which are published into the dead letter topic"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &deadLetter{
+		topic:         topic,
+		consumerGroup: consumerGroup,
+
+		producer: producer,
+		counter:  counter,
+	}
+}
+
+// Publishes the original message with the reason of its failure into
+// the dead letter topic. The publish span continues the trace of the
+// message & links to the span of its last failed processing.
+func (d *deadLetter) publish(
+	ctx context.Context,
+	msg *sarama.ConsumerMessage,
+	attempts int,
+	errorType string,
+	cause error,
+	failed trace.SpanContext,
+) error {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+7)
+	for _, header := range msg.Headers {
+		headers = append(headers, *header)
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(DeadLetterErrorTypeHeader), Value: []byte(errorType)},
+		sarama.RecordHeader{Key: []byte(DeadLetterErrorMessageHeader), Value: []byte(cause.Error())},
+		sarama.RecordHeader{Key: []byte(DeadLetterAttemptsHeader), Value: []byte(strconv.Itoa(attempts))},
+		sarama.RecordHeader{Key: []byte(DeadLetterTopicHeader), Value: []byte(originalTopic(msg))},
+		sarama.RecordHeader{Key: []byte(DeadLetterPartitionHeader), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		sarama.RecordHeader{Key: []byte(DeadLetterOffsetHeader), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(DeadLetterConsumerGroupHeader), Value: []byte(d.consumerGroup)},
+	)
+
+	dlqMsg := &sarama.ProducerMessage{
+		Topic:   d.topic,
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	}
+	if msg.Key != nil {
+		dlqMsg.Key = sarama.ByteEncoder(msg.Key)
+	}
+
+	link := trace.Link{
+		SpanContext: failed,
+		Attributes:  otelsemconv.WithMessagingKafkaSourceAttributes(msg),
+	}
+	if err := d.producer.Publish(ctx, dlqMsg, link); err != nil {
+		return err
+	}
+
+	d.counter.Add(ctx, 1, metric.WithAttributes(
+		otelsemconv.MessagingSystem.String("kafka"),
+		otelsemconv.MessagingDestinationName.String(d.topic),
+		otelsemconv.MessagingKafkaSourceTopic.String(originalTopic(msg)),
+		otelsemconv.MessagingKafkaConsumerGroup.String(d.consumerGroup),
+		otelsemconv.ErrorType.String(errorType),
+	))
+	return nil
+}
+
+// Returns a low cardinality type of the DB error which is the number of
+// the MySQL error if there is any
+func dbErrorType(
+	err error,
+) string {
+	var merr *mysqldriver.MySQLError
+	if errors.As(err, &merr) {
+		return strconv.Itoa(int(merr.Number))
+	}
+	return "db"
+}
@@ -0,0 +1,237 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	otelkafka "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/kafka"
+	otelsemconv "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers which the retried messages carry in addition to their original
+// ones. They are replaced on every retry.
+const (
+	RetryHeaderPrefix        = "retry."
+	RetryAttemptHeader       = "retry.attempt"
+	RetryDueHeader           = "retry.due"
+	RetryOriginalTopicHeader = "retry.original.topic"
+	RetryPreviousHeader      = "retry.previous"
+	RetryErrorTypeHeader     = "retry.error.type"
+	RetryErrorMessageHeader  = "retry.error.message"
+)
+
+// Topic which the failed messages wait in for the delay before they are
+// processed again
+type RetryTopic struct {
+	Topic string
+	Delay time.Duration
+}
+
+// Parses the retry topics out of a comma separated list of topic:delay
+// pairs (e.g. "otel-retry-5s:5s,otel-retry-1m:1m")
+func ParseRetryTopics(
+	value string,
+) (
+	[]RetryTopic,
+	error,
+) {
+	retryTopics := []RetryTopic{}
+	for _, pair := range strings.Split(value, ",") {
+		topic, delay, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || topic == "" {
+			return nil, fmt.Errorf("retry topic %q is not of the form topic:delay", pair)
+		}
+		parsed, err := time.ParseDuration(delay)
+		if err != nil {
+			return nil, fmt.Errorf("delay of retry topic %s is invalid: %w", topic, err)
+		}
+		retryTopics = append(retryTopics, RetryTopic{Topic: topic, Delay: parsed})
+	}
+	return retryTopics, nil
+}
+
+// Republishes the failed messages into the retry topic of their next
+// attempt. The n-th delivery of a message which fails goes into the n-th
+// retry topic.
+type retry struct {
+	topics        []RetryTopic
+	consumerGroup string
+
+	producer *otelkafka.KafkaProducer
+	counter  metric.Int64Counter
+}
+
+func newRetry(
+	topics []RetryTopic,
+	consumerGroup string,
+	producer *otelkafka.KafkaProducer,
+) *retry {
+
+	// Create retry counter
+	meter := otel.GetMeterProvider().Meter(otelsemconv.KafkaConsumerName)
+	counter, err := meter.Int64Counter(
+		otelsemconv.MessagingConsumerRetriesName,
+		metric.WithUnit("{message}"),
+		metric.WithDescription("Number of messages which are published into a retry topic"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &retry{
+		topics:        topics,
+		consumerGroup: consumerGroup,
+
+		producer: producer,
+		counter:  counter,
+	}
+}
+
+// Returns whether there is a retry topic left for the message after its
+// given delivery
+func (r *retry) hasNext(
+	delivery int,
+) bool {
+	return delivery <= len(r.topics)
+}
+
+// Publishes the message into the retry topic of its next delivery with
+// the time it is due. The publish span continues the trace of the message
+// & links to the span of its last failed processing which the next
+// delivery links to as well.
+func (r *retry) publish(
+	ctx context.Context,
+	msg *sarama.ConsumerMessage,
+	delivery int,
+	errorType string,
+	cause error,
+	failed trace.SpanContext,
+) error {
+	next := r.topics[delivery-1]
+	originalTopic := originalTopic(msg)
+
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+6)
+	for _, header := range msg.Headers {
+		if !strings.HasPrefix(string(header.Key), RetryHeaderPrefix) {
+			headers = append(headers, *header)
+		}
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(RetryAttemptHeader), Value: []byte(strconv.Itoa(delivery + 1))},
+		sarama.RecordHeader{Key: []byte(RetryDueHeader), Value: []byte(strconv.FormatInt(time.Now().Add(next.Delay).UnixMilli(), 10))},
+		sarama.RecordHeader{Key: []byte(RetryOriginalTopicHeader), Value: []byte(originalTopic)},
+		sarama.RecordHeader{Key: []byte(RetryPreviousHeader), Value: []byte(formatSpanContext(failed))},
+		sarama.RecordHeader{Key: []byte(RetryErrorTypeHeader), Value: []byte(errorType)},
+		sarama.RecordHeader{Key: []byte(RetryErrorMessageHeader), Value: []byte(cause.Error())},
+	)
+
+	retryMsg := &sarama.ProducerMessage{
+		Topic:   next.Topic,
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	}
+	if msg.Key != nil {
+		retryMsg.Key = sarama.ByteEncoder(msg.Key)
+	}
+
+	link := trace.Link{
+		SpanContext: failed,
+		Attributes:  otelsemconv.WithMessagingKafkaSourceAttributes(msg),
+	}
+	if err := r.producer.Publish(ctx, retryMsg, link); err != nil {
+		return err
+	}
+
+	r.counter.Add(ctx, 1, metric.WithAttributes(
+		otelsemconv.MessagingSystem.String("kafka"),
+		otelsemconv.MessagingDestinationName.String(next.Topic),
+		otelsemconv.MessagingKafkaSourceTopic.String(originalTopic),
+		otelsemconv.MessagingKafkaConsumerGroup.String(r.consumerGroup),
+		otelsemconv.ErrorType.String(errorType),
+	))
+	return nil
+}
+
+// Returns the number of the delivery of the message which is 1 unless
+// it is retried
+func deliveryOf(
+	msg *sarama.ConsumerMessage,
+) int {
+	if value := headerOf(msg, RetryAttemptHeader); value != "" {
+		if delivery, err := strconv.Atoi(value); err == nil && delivery > 0 {
+			return delivery
+		}
+	}
+	return 1
+}
+
+// Returns the time when the retried message is due for processing
+func dueOf(
+	msg *sarama.ConsumerMessage,
+) (
+	time.Time,
+	bool,
+) {
+	value := headerOf(msg, RetryDueHeader)
+	if value == "" {
+		return time.Time{}, false
+	}
+	due, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(due), true
+}
+
+// Returns the span of the failed processing of the previous delivery
+func previousOf(
+	msg *sarama.ConsumerMessage,
+) trace.SpanContext {
+	value := headerOf(msg, RetryPreviousHeader)
+	if value == "" {
+		return trace.SpanContext{}
+	}
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{
+		"traceparent": value,
+	})
+	return trace.SpanContextFromContext(ctx)
+}
+
+// Returns the topic which the message is originally consumed from
+func originalTopic(
+	msg *sarama.ConsumerMessage,
+) string {
+	if topic := headerOf(msg, RetryOriginalTopicHeader); topic != "" {
+		return topic
+	}
+	return msg.Topic
+}
+
+// Formats the span context as W3C traceparent
+func formatSpanContext(
+	spanContext trace.SpanContext,
+) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), spanContext), carrier)
+	return carrier["traceparent"]
+}
+
+func headerOf(
+	msg *sarama.ConsumerMessage,
+	key string,
+) string {
+	for _, header := range msg.Headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,326 @@
+// Events which the simulator publishes & the kafkaconsumer consumes. The
+// package is copied into both modules & the copies must be changed together
+// (only the semconv import differs).
+package event
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// Type of the events which are published for the simulated users
+	TypeUserCreated = "user.created"
+
+	EncodingJson     = "json"
+	EncodingProtobuf = "protobuf"
+
+	ContentTypeJson     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+
+	// Message header which carries the content type of the event
+	ContentTypeHeader = "content-type"
+)
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported encoding")
+	ErrMalformed           = errors.New("malformed event")
+)
+
+// Versioned envelope around the payload of a message
+type Envelope struct {
+	Id        string            `json:"id"`
+	Type      string            `json:"type"`
+	Version   int               `json:"version"`
+	Timestamp time.Time         `json:"timestamp"`
+	Payload   map[string]string `json:"payload"`
+}
+
+// Creates an envelope with a random id for the given payload
+func New(
+	eventType string,
+	version int,
+	payload map[string]string,
+) *Envelope {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return &Envelope{
+		Id:        hex.EncodeToString(id),
+		Type:      eventType,
+		Version:   version,
+		Timestamp: time.Now().UTC(),
+		Payload:   payload,
+	}
+}
+
+// Checks whether the encoding is known
+func ValidateEncoding(
+	encoding string,
+) error {
+	_, err := ContentTypeOf(encoding)
+	return err
+}
+
+// Returns the content type of the encoding
+func ContentTypeOf(
+	encoding string,
+) (
+	string,
+	error,
+) {
+	switch encoding {
+	case EncodingJson:
+		return ContentTypeJson, nil
+	case EncodingProtobuf:
+		return ContentTypeProtobuf, nil
+	default:
+		return "", fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// Returns the encoding of the content type
+func EncodingOf(
+	contentType string,
+) (
+	string,
+	error,
+) {
+	switch contentType {
+	case ContentTypeJson:
+		return EncodingJson, nil
+	case ContentTypeProtobuf:
+		return EncodingProtobuf, nil
+	default:
+		return "", fmt.Errorf("%w %q", ErrUnsupportedEncoding, contentType)
+	}
+}
+
+// Encodes the envelope with the given encoding
+func Marshal(
+	envelope *Envelope,
+	encoding string,
+) (
+	[]byte,
+	error,
+) {
+	switch encoding {
+	case EncodingJson:
+		return json.Marshal(envelope)
+	case EncodingProtobuf:
+		return marshalProtobuf(envelope), nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// Decodes the envelope with the given encoding
+func Unmarshal(
+	value []byte,
+	encoding string,
+) (
+	*Envelope,
+	error,
+) {
+	envelope := &Envelope{}
+	switch encoding {
+	case EncodingJson:
+		if err := json.Unmarshal(value, envelope); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrMalformed, err.Error())
+		}
+	case EncodingProtobuf:
+		if err := unmarshalProtobuf(value, envelope); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrMalformed, err.Error())
+		}
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+	return envelope, nil
+}
+
+// Field numbers of envelope.proto
+const (
+	fieldId        protowire.Number = 1
+	fieldType      protowire.Number = 2
+	fieldVersion   protowire.Number = 3
+	fieldTimestamp protowire.Number = 4
+	fieldPayload   protowire.Number = 5
+
+	fieldTimestampSeconds protowire.Number = 1
+	fieldTimestampNanos   protowire.Number = 2
+
+	fieldEntryKey   protowire.Number = 1
+	fieldEntryValue protowire.Number = 2
+)
+
+func marshalProtobuf(
+	envelope *Envelope,
+) []byte {
+	b := []byte{}
+	b = appendString(b, fieldId, envelope.Id)
+	b = appendString(b, fieldType, envelope.Type)
+	if envelope.Version != 0 {
+		b = protowire.AppendTag(b, fieldVersion, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(envelope.Version))
+	}
+
+	if !envelope.Timestamp.IsZero() {
+		ts := []byte{}
+		ts = protowire.AppendTag(ts, fieldTimestampSeconds, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(envelope.Timestamp.Unix()))
+		ts = protowire.AppendTag(ts, fieldTimestampNanos, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(envelope.Timestamp.Nanosecond()))
+		b = protowire.AppendTag(b, fieldTimestamp, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	}
+
+	// Map entries are messages of key & value
+	for key, value := range envelope.Payload {
+		entry := []byte{}
+		entry = appendString(entry, fieldEntryKey, key)
+		entry = appendString(entry, fieldEntryValue, value)
+		b = protowire.AppendTag(b, fieldPayload, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+func appendString(
+	b []byte,
+	num protowire.Number,
+	value string,
+) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func unmarshalProtobuf(
+	b []byte,
+	envelope *Envelope,
+) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == fieldId && typ == protowire.BytesType:
+			value, n := protowire.ConsumeString(b)
+			envelope.Id = value
+			return n, nil
+
+		case num == fieldType && typ == protowire.BytesType:
+			value, n := protowire.ConsumeString(b)
+			envelope.Type = value
+			return n, nil
+
+		case num == fieldVersion && typ == protowire.VarintType:
+			value, n := protowire.ConsumeVarint(b)
+			envelope.Version = int(value)
+			return n, nil
+
+		case num == fieldTimestamp && typ == protowire.BytesType:
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			timestamp, err := unmarshalTimestamp(value)
+			envelope.Timestamp = timestamp
+			return n, err
+
+		case num == fieldPayload && typ == protowire.BytesType:
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			key, val, err := unmarshalEntry(value)
+			if envelope.Payload == nil {
+				envelope.Payload = map[string]string{}
+			}
+			envelope.Payload[key] = val
+			return n, err
+
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+}
+
+func unmarshalTimestamp(
+	b []byte,
+) (
+	time.Time,
+	error,
+) {
+	var seconds, nanos uint64
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == fieldTimestampSeconds && typ == protowire.VarintType:
+			value, n := protowire.ConsumeVarint(b)
+			seconds = value
+			return n, nil
+		case num == fieldTimestampNanos && typ == protowire.VarintType:
+			value, n := protowire.ConsumeVarint(b)
+			nanos = value
+			return n, nil
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+	return time.Unix(int64(seconds), int64(nanos)).UTC(), err
+}
+
+func unmarshalEntry(
+	b []byte,
+) (
+	string,
+	string,
+	error,
+) {
+	var key, value string
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == fieldEntryKey && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			key = v
+			return n, nil
+		case num == fieldEntryValue && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			value = v
+			return n, nil
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+	return key, value, err
+}
+
+// Walks through the fields of a message & hands each of them to the
+// given function which returns how many bytes of the value it consumed
+func consumeFields(
+	b []byte,
+	consume func(protowire.Number, protowire.Type, []byte) (int, error),
+) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := consume(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
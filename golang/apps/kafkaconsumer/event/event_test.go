@@ -0,0 +1,150 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newUserCreated() *Envelope {
+	return New(TypeUserCreated, 2, map[string]string{
+		"name": "elon",
+		"tier": "premium",
+	})
+}
+
+func Test_EnvelopeSurvivesEncodings(t *testing.T) {
+	for _, encoding := range []string{EncodingJson, EncodingProtobuf} {
+		envelope := newUserCreated()
+
+		value, err := Marshal(envelope, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := Unmarshal(value, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if decoded.Id != envelope.Id ||
+			decoded.Type != envelope.Type ||
+			decoded.Version != envelope.Version ||
+			!decoded.Timestamp.Equal(envelope.Timestamp) ||
+			decoded.Payload["name"] != "elon" ||
+			decoded.Payload["tier"] != "premium" ||
+			len(decoded.Payload) != 2 {
+			t.Errorf("%s: expected %+v, got %+v.", encoding, envelope, decoded)
+		}
+	}
+}
+
+func Test_MalformedProtobufRejected(t *testing.T) {
+	value, _ := Marshal(newUserCreated(), EncodingProtobuf)
+
+	_, err := Unmarshal(value[:len(value)-1], EncodingProtobuf)
+	if !errors.Is(err, ErrMalformed) {
+		t.Errorf("Expected malformed error, got %v.", err)
+	}
+}
+
+func Test_RegistryValidatesPayload(t *testing.T) {
+	registry := DefaultRegistry()
+
+	if err := registry.Validate(newUserCreated()); err != nil {
+		t.Errorf("Expected valid event, got %v.", err)
+	}
+
+	missing := New(TypeUserCreated, 1, map[string]string{})
+	if err := registry.Validate(missing); !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("Expected schema mismatch for missing field, got %v.", err)
+	}
+
+	unknownField := New(TypeUserCreated, 1, map[string]string{"name": "elon", "tier": "free"})
+	if err := registry.Validate(unknownField); !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("Expected schema mismatch for unknown field, got %v.", err)
+	}
+
+	unknownVersion := New(TypeUserCreated, 3, map[string]string{"name": "elon"})
+	if err := registry.Validate(unknownVersion); !errors.Is(err, ErrUnknownSchema) {
+		t.Errorf("Expected unknown schema, got %v.", err)
+	}
+
+	latest, err := registry.Latest(TypeUserCreated)
+	if err != nil || latest.Version != 2 {
+		t.Errorf("Expected latest version 2, got %v.", latest)
+	}
+}
+
+func Test_RegistryLoadedFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schemas.json")
+	content := `[{"type": "user.created", "version": 1, "fields": [{"name": "name", "required": true}]}]`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Validate(newUserCreated()); !errors.Is(err, ErrUnknownSchema) {
+		t.Errorf("Expected version 2 to be unknown, got %v.", err)
+	}
+}
+
+func Test_CodecFailuresRecorded(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	// Producer knows version 2 whereas consumer only knows version 1
+	producer := NewCodec(DefaultRegistry(), EncodingProtobuf)
+	consumerRegistry, _ := NewRegistry([]*Schema{
+		{Type: TypeUserCreated, Version: 1, Fields: []Field{{Name: "name", Required: true}}},
+	})
+	consumer := NewCodec(consumerRegistry, EncodingProtobuf)
+
+	value, contentType, err := producer.Encode(context.Background(), newUserCreated())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consumer.Decode(context.Background(), value, contentType); !errors.Is(err, ErrUnknownSchema) {
+		t.Errorf("Expected unknown schema, got %v.", err)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 2 || spans[1].Status().Code != codes.Error {
+		t.Fatalf("Expected failed decode span, got %v.", spans)
+	}
+
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	failures := int64(0)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != EventCodecFailuresName {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				failures += dp.Value
+				if errorType, _ := dp.Attributes.Value("error.type"); errorType.AsString() != "unknown_schema" {
+					t.Errorf("Expected unknown_schema error type, got %s.", errorType.AsString())
+				}
+			}
+		}
+	}
+	if failures != 1 {
+		t.Errorf("Expected 1 failure, got %d.", failures)
+	}
+}
@@ -0,0 +1,80 @@
+package kafkaconfig
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// Test vector of RFC 7677
+func Test_ScramSha256Exchange(t *testing.T) {
+	c := newScramClient(sha256Hash)
+	if err := c.Begin("user", "pencil", ""); err != nil {
+		t.Fatal(err)
+	}
+	c.nonce = "rOprNGfwEbeRWgbNEkqO"
+
+	clientFirst, err := c.Step("")
+	if err != nil || clientFirst != "n,,n=user,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Fatalf("Unexpected client first message %q.", clientFirst)
+	}
+
+	clientFinal, err := c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if clientFinal != expected {
+		t.Fatalf("Expected client final message %q, got %q.", expected, clientFinal)
+	}
+
+	if _, err := c.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil || !c.Done() {
+		t.Fatalf("Server signature should be accepted, got %v.", err)
+	}
+}
+
+func Test_ScramServerSignatureVerified(t *testing.T) {
+	c := newScramClient(sha256Hash)
+	c.Begin("user", "pencil", "")
+	c.nonce = "rOprNGfwEbeRWgbNEkqO"
+
+	c.Step("")
+	c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if _, err := c.Step("v=AAAA"); err == nil || c.Done() {
+		t.Error("Forged server signature should be rejected.")
+	}
+}
+
+func Test_SharedSettingsApplied(t *testing.T) {
+	config, err := New(
+		WithClientId("simulator"),
+		WithSaslMechanism(SaslMechanismScramSha512),
+		WithSaslUsername("elon"),
+		WithSaslPassword("secret"),
+	).NewSaramaConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ClientID != "simulator" ||
+		!config.Net.SASL.Enable ||
+		config.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA512 ||
+		config.Net.SASL.SCRAMClientGeneratorFunc == nil {
+		t.Error("Client id & SASL should be configured.")
+	}
+	if err := config.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_InvalidSettingsRejected(t *testing.T) {
+	if _, err := New(WithSaslMechanism("GSSAPI"), WithSaslUsername("elon")).NewSaramaConfig(); err == nil {
+		t.Error("Unknown SASL mechanism should be rejected.")
+	}
+	if _, err := New(WithSaslMechanism(SaslMechanismPlain)).NewSaramaConfig(); err == nil {
+		t.Error("SASL without username should be rejected.")
+	}
+	if _, err := New(WithTlsEnabled("true"), WithTlsCaPath("/does/not/exist")).NewSaramaConfig(); err == nil {
+		t.Error("Missing CA file should be rejected.")
+	}
+}
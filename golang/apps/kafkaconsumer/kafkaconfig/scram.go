@@ -0,0 +1,191 @@
+package kafkaconfig
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/secure/precis"
+)
+
+var (
+	sha256Hash = sha256.New
+	sha512Hash = sha512.New
+)
+
+// GS2 header of a client which neither binds the channel nor asks for
+// another authorization identity
+const gs2Header = "n,,"
+
+// Client side of the SCRAM authentication (RFC 5802) which sarama runs
+// for the SCRAM-SHA-256 & SCRAM-SHA-512 mechanisms
+type scramClient struct {
+	hash func() hash.Hash
+
+	username string
+	password string
+	nonce    string
+
+	clientFirstBare string
+	serverSignature []byte
+	step            int
+	done            bool
+}
+
+func newScramClient(
+	hash func() hash.Hash,
+) *scramClient {
+	return &scramClient{
+		hash: hash,
+	}
+}
+
+func (c *scramClient) Begin(
+	username string,
+	password string,
+	_ string,
+) error {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	// Passwords are prepared with the PRECIS profile which supersedes
+	// SASLprep (RFC 8265) so that their unicode forms derive the same key
+	prepared, err := precis.OpaqueString.String(password)
+	if err != nil {
+		return fmt.Errorf("scram: invalid password: %w", err)
+	}
+
+	c.username = username
+	c.password = prepared
+	c.nonce = base64.RawStdEncoding.EncodeToString(nonce)
+	c.step = 0
+	c.done = false
+	return nil
+}
+
+func (c *scramClient) Step(
+	challenge string,
+) (
+	string,
+	error,
+) {
+	c.step++
+	switch c.step {
+	case 1:
+		return c.clientFirst(), nil
+	case 2:
+		return c.clientFinal(challenge)
+	case 3:
+		return "", c.verifyServerFinal(challenge)
+	default:
+		return "", errors.New("scram: unexpected challenge after authentication")
+	}
+}
+
+func (c *scramClient) Done() bool {
+	return c.done
+}
+
+func (c *scramClient) clientFirst() string {
+	// Usernames escape the separators of the attributes
+	username := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(c.username)
+	c.clientFirstBare = "n=" + username + ",r=" + c.nonce
+	return gs2Header + c.clientFirstBare
+}
+
+func (c *scramClient) clientFinal(
+	serverFirst string,
+) (
+	string,
+	error,
+) {
+	attrs := parseScramAttributes(serverFirst)
+
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, c.nonce) {
+		return "", errors.New("scram: server nonce does not extend the client nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return "", fmt.Errorf("scram: invalid salt: %w", err)
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 1 {
+		return "", fmt.Errorf("scram: invalid iteration count %q", attrs["i"])
+	}
+
+	clientFinalWithoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(gs2Header)) + ",r=" + nonce
+	authMessage := []byte(c.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+
+	saltedPassword := pbkdf2.Key([]byte(c.password), salt, iterations, c.hash().Size(), c.hash)
+	clientKey := c.hmac(saltedPassword, []byte("Client Key"))
+	storedKey := c.sum(clientKey)
+	clientSignature := c.hmac(storedKey, authMessage)
+
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	serverKey := c.hmac(saltedPassword, []byte("Server Key"))
+	c.serverSignature = c.hmac(serverKey, authMessage)
+
+	return clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) verifyServerFinal(
+	serverFinal string,
+) error {
+	attrs := parseScramAttributes(serverFinal)
+	if e, ok := attrs["e"]; ok {
+		return fmt.Errorf("scram: server rejected authentication: %s", e)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(signature, c.serverSignature) {
+		return errors.New("scram: invalid server signature")
+	}
+
+	c.done = true
+	return nil
+}
+
+func (c *scramClient) hmac(
+	key []byte,
+	message []byte,
+) []byte {
+	mac := hmac.New(c.hash, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+func (c *scramClient) sum(
+	message []byte,
+) []byte {
+	h := c.hash()
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// Parses the comma separated key=value attributes of a SCRAM message
+func parseScramAttributes(
+	message string,
+) map[string]string {
+	attrs := map[string]string{}
+	for _, attr := range strings.Split(message, ",") {
+		if key, value, ok := strings.Cut(attr, "="); ok {
+			attrs[key] = value
+		}
+	}
+	return attrs
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/config"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/consumer"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/event"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/kafkaconfig"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/logger"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/mysql"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel"
@@ -53,7 +56,7 @@ func main() {
 	db.CreateDatabaseConnection()
 	defer db.Instance.Close()
 
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	// Instantiate Kafka consumer
@@ -62,10 +65,51 @@ func main() {
 		consumer.WithBrokerAddress(cfg.KafkaBrokerAddress),
 		consumer.WithBrokerTopic(cfg.KafkaTopic),
 		consumer.WithConsumerGroupId(cfg.KafkaGroupId),
+		consumer.WithClientConfig(createKafkaClientConfig(cfg)),
+		consumer.WithSchemaRegistry(createSchemaRegistry(cfg)),
+		consumer.WithMaxAttempts(cfg.KafkaMaxAttempts),
+		consumer.WithRetryTopics(cfg.KafkaRetryTopics),
+		consumer.WithDeadLetterTopic(cfg.KafkaDeadLetterTopic),
+		consumer.WithBatchSize(cfg.KafkaBatchSize),
+		consumer.WithBatchTimeout(cfg.KafkaBatchTimeout),
 	)
+	// Consume until the interrupt
 	if err := kafkaConsumer.StartConsumerGroup(ctx); err != nil {
 		panic(err.Error())
 	}
+}
 
-	<-ctx.Done()
+// Creates the connection settings of the Kafka consumer
+func createKafkaClientConfig(
+	cfg *config.KafkaConsumerConfig,
+) *kafkaconfig.ClientConfig {
+	// The service name is the client id unless another one is given
+	return kafkaconfig.New(
+		kafkaconfig.WithClientId(cfg.ServiceName),
+		kafkaconfig.WithClientId(cfg.KafkaClientId),
+		kafkaconfig.WithTlsEnabled(cfg.KafkaTlsEnabled),
+		kafkaconfig.WithTlsCaPath(cfg.KafkaTlsCaPath),
+		kafkaconfig.WithTlsCertPath(cfg.KafkaTlsCertPath),
+		kafkaconfig.WithTlsKeyPath(cfg.KafkaTlsKeyPath),
+		kafkaconfig.WithTlsInsecureSkipVerify(cfg.KafkaTlsInsecureSkipVerify),
+		kafkaconfig.WithSaslMechanism(cfg.KafkaSaslMechanism),
+		kafkaconfig.WithSaslUsername(cfg.KafkaSaslUsername),
+		kafkaconfig.WithSaslPassword(cfg.KafkaSaslPassword),
+	)
+}
+
+// Loads the schema registry from the given file or falls back to the
+// built-in schemas
+func createSchemaRegistry(
+	cfg *config.KafkaConsumerConfig,
+) *event.Registry {
+	if cfg.SchemaRegistryPath == "" {
+		return event.DefaultRegistry()
+	}
+
+	registry, err := event.LoadRegistry(cfg.SchemaRegistryPath)
+	if err != nil {
+		panic(err)
+	}
+	return registry
 }
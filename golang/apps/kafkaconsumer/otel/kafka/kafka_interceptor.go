@@ -3,16 +3,32 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/IBM/sarama"
 	semconv "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/semconv/v1.24.0"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// Partitions are claimed by the session after a rebalance
+	RebalanceAssign = "assign"
+
+	// Partitions are released by the session before the next rebalance
+	RebalanceRevoke = "revoke"
+)
+
+var rebalanceEvents = map[string]string{
+	RebalanceAssign: "partitions assigned",
+	RebalanceRevoke: "partitions revoked",
+}
+
 type KafkaConsumer struct {
 	tracer     trace.Tracer
 	meter      metric.Meter
@@ -93,3 +109,154 @@ func (k *KafkaConsumer) Intercept(
 
 	return ctx, endConsume
 }
+
+// Records the partitions which the session of the consumer group claims
+// after a rebalance (assign) or releases before the next one (revoke)
+// within a span. Every topic of the session is an event of the span.
+func (k *KafkaConsumer) Rebalance(
+	ctx context.Context,
+	session sarama.ConsumerGroupSession,
+	consumerGroup string,
+	operation string,
+) {
+	claims := session.Claims()
+
+	// Report the topics in a fixed order
+	topics := make([]string, 0, len(claims))
+	for topic := range claims {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	_, span := k.tracer.Start(
+		ctx,
+		fmt.Sprintf("%s %s", consumerGroup, operation),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			semconv.MessagingSystem.String("kafka"),
+			semconv.MessagingKafkaConsumerGroup.String(consumerGroup),
+			semconv.MessagingKafkaConsumerMemberId.String(session.MemberID()),
+			semconv.MessagingKafkaConsumerGenerationId.Int(int(session.GenerationID())),
+			semconv.MessagingKafkaConsumerRebalanceOperation.String(operation),
+		),
+	)
+	defer span.End()
+
+	count := 0
+	for _, topic := range topics {
+		partitions := make([]int64, 0, len(claims[topic]))
+		for _, partition := range claims[topic] {
+			partitions = append(partitions, int64(partition))
+		}
+		sort.Slice(partitions, func(i, j int) bool {
+			return partitions[i] < partitions[j]
+		})
+		count += len(partitions)
+
+		span.AddEvent(rebalanceEvents[operation], trace.WithAttributes(
+			semconv.MessagingDestinationName.String(topic),
+			semconv.MessagingKafkaDestinationPartitions.Int64Slice(partitions),
+		))
+	}
+	span.SetAttributes(semconv.MessagingKafkaPartitionCount.Int(count))
+}
+
+// Starts a span for one attempt of processing the received message which
+// links to the previous failed attempt if there is any. The returned
+// function records the outcome of the attempt & ends the span.
+func (k *KafkaConsumer) StartProcess(
+	ctx context.Context,
+	msg *sarama.ConsumerMessage,
+	consumerGroup string,
+	attempt int,
+	previous trace.SpanContext,
+) (
+	context.Context,
+	func(error),
+) {
+	links := []trace.Link{}
+	if previous.IsValid() {
+		links = append(links, trace.Link{SpanContext: previous})
+	}
+
+	ctx, span := k.tracer.Start(
+		ctx,
+		fmt.Sprintf("%s process", msg.Topic),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			semconv.MessagingSystem.String("kafka"),
+			semconv.MessagingOperation.String(semconv.MessagingOperationProcess),
+			semconv.MessagingDestinationName.String(msg.Topic),
+			semconv.MessagingKafkaDestinationPartition.Int(int(msg.Partition)),
+			semconv.MessagingKafkaConsumerGroup.String(consumerGroup),
+			semconv.MessagingKafkaMessageOffset.Int64(msg.Offset),
+			semconv.MessagingKafkaConsumerAttempt.Int(attempt),
+		),
+		trace.WithLinks(links...),
+	)
+
+	endProcess := func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	return ctx, endProcess
+}
+
+// Starts a span for processing the received messages as a single batch
+// which links to the producer context of every message. The returned
+// function records the outcome of the batch & ends the span.
+func (k *KafkaConsumer) StartBatchProcess(
+	ctx context.Context,
+	msgs []*sarama.ConsumerMessage,
+	consumerGroup string,
+) (
+	context.Context,
+	func(error),
+) {
+	links := make([]trace.Link, 0, len(msgs))
+	for _, msg := range msgs {
+		headers := propagation.MapCarrier{}
+		for _, recordHeader := range msg.Headers {
+			headers[string(recordHeader.Key)] = string(recordHeader.Value)
+		}
+
+		spanContext := trace.SpanContextFromContext(k.propagator.Extract(context.Background(), headers))
+		if spanContext.IsValid() {
+			links = append(links, trace.Link{
+				SpanContext: spanContext,
+				Attributes: []attribute.KeyValue{
+					semconv.MessagingKafkaMessageOffset.Int64(msg.Offset),
+				},
+			})
+		}
+	}
+
+	ctx, span := k.tracer.Start(
+		ctx,
+		fmt.Sprintf("%s process", msgs[0].Topic),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystem.String("kafka"),
+			semconv.MessagingOperation.String(semconv.MessagingOperationProcess),
+			semconv.MessagingDestinationName.String(msgs[0].Topic),
+			semconv.MessagingKafkaDestinationPartition.Int(int(msgs[0].Partition)),
+			semconv.MessagingKafkaConsumerGroup.String(consumerGroup),
+			semconv.MessagingBatchMessageCount.Int(len(msgs)),
+		),
+		trace.WithLinks(links...),
+	)
+
+	endProcess := func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	return ctx, endProcess
+}
@@ -0,0 +1,159 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	semconv "github.com/utr1903/opentelemetry-playground/golang/apps/kafkaconsumer/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type KafkaProducer struct {
+	producer sarama.SyncProducer
+
+	tracer     trace.Tracer
+	meter      metric.Meter
+	propagator propagation.TextMapPropagator
+
+	latency  metric.Float64Histogram
+	failures metric.Int64Counter
+}
+
+// Wraps the given sync producer which the consumer republishes the
+// messages with (e.g. into a dead letter topic)
+func NewProducer(
+	producer sarama.SyncProducer,
+) *KafkaProducer {
+
+	// Instantiate trace provider
+	tracer := otel.GetTracerProvider().Tracer(semconv.KafkaProducerName)
+
+	// Instantiate meter provider
+	meter := otel.GetMeterProvider().Meter(semconv.KafkaProducerName)
+
+	// Instantiate propagator
+	propagator := otel.GetTextMapPropagator()
+
+	// Create producer latency histogram
+	latency, err := meter.Float64Histogram(
+		semconv.MessagingProducerLatencyName,
+		metric.WithUnit("ms"),
+		metric.WithDescription("Measures the duration of publish operation"),
+		metric.WithExplicitBucketBoundaries(semconv.MessagingExplicitBucketBoundaries...),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	// Create producer failures counter
+	failures, err := meter.Int64Counter(
+		semconv.MessagingProducerFailuresName,
+		metric.WithUnit("{message}"),
+		metric.WithDescription("Number of messages which could not be published"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &KafkaProducer{
+		producer: producer,
+
+		tracer:     tracer,
+		meter:      meter,
+		propagator: propagator,
+
+		latency:  latency,
+		failures: failures,
+	}
+}
+
+// Publishes the message within a producer span & waits until it is
+// acknowledged. The links are added to the span.
+func (k *KafkaProducer) Publish(
+	ctx context.Context,
+	msg *sarama.ProducerMessage,
+	links ...trace.Link,
+) error {
+	publishStartTime := time.Now()
+
+	attrs := semconv.WithMessagingKafkaProducerAttributes(msg)
+	ctx, span := k.tracer.Start(
+		ctx,
+		fmt.Sprintf("%s publish", msg.Topic),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrs...),
+		trace.WithLinks(links...),
+	)
+	defer span.End()
+
+	k.inject(ctx, msg)
+
+	partition, offset, err := k.producer.SendMessage(msg)
+	if err != nil {
+		attrs = append(attrs, semconv.ErrorType.String(errorType(err)))
+		k.failures.Add(ctx, 1, metric.WithAttributes(attrs...))
+
+		span.SetAttributes(semconv.ErrorType.String(errorType(err)))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(semconv.WithMessagingKafkaAckAttributes(partition, offset)...)
+	}
+
+	// Record producer latency
+	elapsedTime := float64(time.Since(publishStartTime)) / float64(time.Millisecond)
+	k.latency.Record(ctx, elapsedTime, metric.WithAttributes(attrs...))
+
+	return err
+}
+
+// Injects the tracing info of the context into the message headers. The
+// tracing info which the message already carries is replaced.
+func (k *KafkaProducer) inject(
+	ctx context.Context,
+	msg *sarama.ProducerMessage,
+) {
+	carrier := propagation.MapCarrier{}
+	k.propagator.Inject(ctx, carrier)
+
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+len(carrier))
+	for _, header := range msg.Headers {
+		if _, ok := carrier[string(header.Key)]; !ok {
+			headers = append(headers, header)
+		}
+	}
+	for key, value := range carrier {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	msg.Headers = headers
+}
+
+// Returns a low cardinality type of the producer error
+func errorType(
+	err error,
+) string {
+	var kerr sarama.KError
+	if errors.As(err, &kerr) {
+		return strconv.Itoa(int(kerr))
+	}
+
+	switch {
+	case errors.Is(err, sarama.ErrOutOfBrokers):
+		return "out_of_brokers"
+	case errors.Is(err, sarama.ErrNotConnected):
+		return "not_connected"
+	case errors.Is(err, sarama.ErrShuttingDown):
+		return "shutting_down"
+	case errors.Is(err, sarama.ErrMessageTooLarge):
+		return "message_too_large"
+	}
+	return fmt.Sprintf("%T", err)
+}
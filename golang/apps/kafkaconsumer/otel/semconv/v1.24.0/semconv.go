@@ -16,6 +16,9 @@ const (
 	ExceptionEscapedName = "exception.escaped"
 	ExceptionEscaped     = attribute.Key(ExceptionEscapedName)
 
+	ErrorTypeName = "error.type"
+	ErrorType     = attribute.Key(ErrorTypeName)
+
 	NetworkProtocolVersionName = "network.protocol.version"
 	NetworkProtocolVersion     = attribute.Key(NetworkProtocolVersionName)
 	UserAgentOriginalName      = "user_agent.original"
@@ -30,12 +33,27 @@ const (
 	ClientPort                 = attribute.Key(ClientPortName)
 )
 
+// DB
+// https://github.com/open-telemetry/semantic-conventions/tree/v1.24.0/docs/database
+const (
+	// Custom
+	DbOperationBatchSizeName = "db.operation.batch.size"
+	DbOperationBatchSize     = attribute.Key(DbOperationBatchSizeName)
+)
+
 // KAFKA
 // https://github.com/open-telemetry/semantic-conventions/tree/v1.24.0/docs/messaging
 const (
 	KafkaConsumerName = "kafka_consumer"
+	KafkaProducerName = "kafka_producer"
 
 	MessagingConsumerLatencyName = "messaging.receive.duration"
+	MessagingProducerLatencyName = "messaging.publish.duration"
+
+	// Custom
+	MessagingProducerFailuresName    = "messaging.publish.failures"
+	MessagingConsumerDeadLettersName = "messaging.consumer.dead_letters"
+	MessagingConsumerRetriesName     = "messaging.consumer.retries"
 
 	MessagingSystemName          = "messaging.system"
 	MessagingSystem              = attribute.Key(MessagingSystemName)
@@ -46,6 +64,13 @@ const (
 	MessagingDestinationNameName = "messaging.destination.name"
 	MessagingDestinationName     = attribute.Key(MessagingDestinationNameName)
 
+	MessagingBatchMessageCountName = "messaging.batch.message_count"
+	MessagingBatchMessageCount     = attribute.Key(MessagingBatchMessageCountName)
+
+	MessagingOperationReceive = "receive"
+	MessagingOperationProcess = "process"
+	MessagingOperationPublish = "publish"
+
 	// KAFKA
 	MessagingKafkaDestinationPartitionName = "messaging.kafka.destination.partition"
 	MessagingKafkaDestinationPartition     = attribute.Key(MessagingKafkaDestinationPartitionName)
@@ -53,6 +78,28 @@ const (
 	MessagingKafkaConsumerGroup            = attribute.Key(MessagingKafkaConsumerGroupName)
 	MessagingKafkaMessageOffsetName        = "messaging.kafka.message.offset"
 	MessagingKafkaMessageOffset            = attribute.Key(MessagingKafkaMessageOffsetName)
+
+	// KAFKA CONSUMER GROUP
+	MessagingKafkaConsumerMemberIdName           = "messaging.kafka.consumer.member_id"
+	MessagingKafkaConsumerMemberId               = attribute.Key(MessagingKafkaConsumerMemberIdName)
+	MessagingKafkaConsumerGenerationIdName       = "messaging.kafka.consumer.generation_id"
+	MessagingKafkaConsumerGenerationId           = attribute.Key(MessagingKafkaConsumerGenerationIdName)
+	MessagingKafkaConsumerRebalanceOperationName = "messaging.kafka.consumer.rebalance.operation"
+	MessagingKafkaConsumerRebalanceOperation     = attribute.Key(MessagingKafkaConsumerRebalanceOperationName)
+	MessagingKafkaDestinationPartitionsName      = "messaging.kafka.destination.partitions"
+	MessagingKafkaDestinationPartitions          = attribute.Key(MessagingKafkaDestinationPartitionsName)
+	MessagingKafkaPartitionCountName             = "messaging.kafka.partition_count"
+	MessagingKafkaPartitionCount                 = attribute.Key(MessagingKafkaPartitionCountName)
+
+	// KAFKA DEAD LETTER
+	MessagingKafkaConsumerAttemptName     = "messaging.kafka.consumer.attempt"
+	MessagingKafkaConsumerAttempt         = attribute.Key(MessagingKafkaConsumerAttemptName)
+	MessagingKafkaSourceTopicName         = "messaging.kafka.source.topic"
+	MessagingKafkaSourceTopic             = attribute.Key(MessagingKafkaSourceTopicName)
+	MessagingKafkaSourcePartitionName     = "messaging.kafka.source.partition"
+	MessagingKafkaSourcePartition         = attribute.Key(MessagingKafkaSourcePartitionName)
+	MessagingKafkaSourceMessageOffsetName = "messaging.kafka.source.message.offset"
+	MessagingKafkaSourceMessageOffset     = attribute.Key(MessagingKafkaSourceMessageOffsetName)
 )
 
 var (
@@ -86,7 +133,7 @@ func WithMessagingKafkaConsumerAttributes(
 
 	// Method, scheme & protocol version
 	attrs = append(attrs, MessagingSystem.String("kafka"))
-	attrs = append(attrs, MessagingOperation.String("receive"))
+	attrs = append(attrs, MessagingOperation.String(MessagingOperationReceive))
 	attrs = append(attrs, MessagingDestinationName.String(msg.Topic))
 	attrs = append(attrs, MessagingKafkaDestinationPartition.Int(int(msg.Partition)))
 	attrs = append(attrs, MessagingKafkaConsumerGroup.String(consumerGroup))
@@ -94,3 +141,36 @@ func WithMessagingKafkaConsumerAttributes(
 
 	return attrs
 }
+
+func WithMessagingKafkaProducerAttributes(
+	msg *sarama.ProducerMessage,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		MessagingSystem.String("kafka"),
+		MessagingOperation.String(MessagingOperationPublish),
+		MessagingDestinationName.String(msg.Topic),
+	}
+}
+
+// Returns the partition & the offset which the broker assigned to the
+// acknowledged message
+func WithMessagingKafkaAckAttributes(
+	partition int32,
+	offset int64,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		MessagingKafkaDestinationPartition.Int(int(partition)),
+		MessagingKafkaMessageOffset.Int64(offset),
+	}
+}
+
+// Returns where the message which is processed comes from
+func WithMessagingKafkaSourceAttributes(
+	msg *sarama.ConsumerMessage,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		MessagingKafkaSourceTopic.String(msg.Topic),
+		MessagingKafkaSourcePartition.Int(int(msg.Partition)),
+		MessagingKafkaSourceMessageOffset.Int64(msg.Offset),
+	}
+}
@@ -7,32 +7,130 @@ type SimulatorConfig struct {
 	// App name
 	ServiceName string
 
+	// App port
+	ServicePort string
+
 	// HTTP server
 	HttpserverRequestInterval string
 	HttpserverEndpoint        string
 	HttpserverPort            string
+	HttpserverMaxVirtualUsers string
+	HttpserverRetryAttempts   string
+	HttpserverRetryBackoff    string
+	HttpserverRetryMaxBackoff string
+	HttpserverConnTracing     string
+	HttpserverErrorMix        string
+
+	HttpserverCircuitBreakerThreshold   string
+	HttpserverCircuitBreakerMinRequests string
+	HttpserverCircuitBreakerCoolDown    string
 
 	// Kafka producer
-	KafkaRequestInterval string
-	KafkaBrokerAddress   string
-	KafkaTopic           string
+	KafkaRequestInterval       string
+	KafkaBrokerAddress         string
+	KafkaTopic                 string
+	KafkaMaxVirtualUsers       string
+	KafkaPublishTimeout        string
+	KafkaBatchSize             string
+	KafkaPartitions            string
+	KafkaKeyStrategy           string
+	KafkaHotKeyRatio           string
+	KafkaMessageEncoding       string
+	KafkaProducerMode          string
+	KafkaTransactionAbortRatio string
+	KafkaTopicsPath            string
+
+	// Kafka connection
+	KafkaClientId              string
+	KafkaTlsEnabled            string
+	KafkaTlsCaPath             string
+	KafkaTlsCertPath           string
+	KafkaTlsKeyPath            string
+	KafkaTlsInsecureSkipVerify string
+	KafkaSaslMechanism         string
+	KafkaSaslUsername          string
+	KafkaSaslPassword          string
+
+	// Schema registry
+	SchemaRegistryPath string
+
+	// Load profile
+	LoadProfilePath string
+
+	// Journeys
+	JourneysPath string
+
+	// Seed of the randomness
+	Seed string
+
+	// Traffic recording & replay
+	TrafficRecordPath  string
+	TrafficReplayPath  string
+	TrafficReplaySpeed string
 
 	// Users
-	Users []string
+	Users             []string
+	UsersPath         string
+	UsersCount        string
+	UsersDistribution string
+	UsersZipfExponent string
 }
 
 // Creates new config object by parsing environment variables
 func NewConfig() *SimulatorConfig {
 	return &SimulatorConfig{
 		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		ServicePort: os.Getenv("APP_PORT"),
 
 		HttpserverRequestInterval: os.Getenv("HTTP_SERVER_REQUEST_INTERVAL"),
 		HttpserverEndpoint:        os.Getenv("HTTP_SERVER_ENDPOINT"),
 		HttpserverPort:            os.Getenv("HTTP_SERVER_PORT"),
+		HttpserverMaxVirtualUsers: os.Getenv("HTTP_SERVER_MAX_VIRTUAL_USERS"),
+		HttpserverRetryAttempts:   os.Getenv("HTTP_SERVER_RETRY_ATTEMPTS"),
+		HttpserverRetryBackoff:    os.Getenv("HTTP_SERVER_RETRY_BACKOFF"),
+		HttpserverRetryMaxBackoff: os.Getenv("HTTP_SERVER_RETRY_MAX_BACKOFF"),
+		HttpserverConnTracing:     os.Getenv("HTTP_SERVER_CONNECTION_TRACING"),
+		HttpserverErrorMix:        os.Getenv("HTTP_SERVER_ERROR_MIX"),
+
+		HttpserverCircuitBreakerThreshold:   os.Getenv("HTTP_SERVER_CIRCUIT_BREAKER_THRESHOLD"),
+		HttpserverCircuitBreakerMinRequests: os.Getenv("HTTP_SERVER_CIRCUIT_BREAKER_MIN_REQUESTS"),
+		HttpserverCircuitBreakerCoolDown:    os.Getenv("HTTP_SERVER_CIRCUIT_BREAKER_COOLDOWN"),
+
+		KafkaRequestInterval:       os.Getenv("KAFKA_REQUEST_INTERVAL"),
+		KafkaBrokerAddress:         os.Getenv("KAFKA_BROKER_ADDRESS"),
+		KafkaTopic:                 os.Getenv("KAFKA_TOPIC"),
+		KafkaMaxVirtualUsers:       os.Getenv("KAFKA_MAX_VIRTUAL_USERS"),
+		KafkaPublishTimeout:        os.Getenv("KAFKA_PUBLISH_TIMEOUT"),
+		KafkaBatchSize:             os.Getenv("KAFKA_BATCH_SIZE"),
+		KafkaPartitions:            os.Getenv("KAFKA_PARTITIONS"),
+		KafkaKeyStrategy:           os.Getenv("KAFKA_KEY_STRATEGY"),
+		KafkaHotKeyRatio:           os.Getenv("KAFKA_HOT_KEY_RATIO"),
+		KafkaMessageEncoding:       os.Getenv("KAFKA_MESSAGE_ENCODING"),
+		KafkaProducerMode:          os.Getenv("KAFKA_PRODUCER_MODE"),
+		KafkaTransactionAbortRatio: os.Getenv("KAFKA_TRANSACTION_ABORT_RATIO"),
+		KafkaTopicsPath:            os.Getenv("KAFKA_TOPICS_PATH"),
+
+		KafkaClientId:              os.Getenv("KAFKA_CLIENT_ID"),
+		KafkaTlsEnabled:            os.Getenv("KAFKA_TLS_ENABLED"),
+		KafkaTlsCaPath:             os.Getenv("KAFKA_TLS_CA_PATH"),
+		KafkaTlsCertPath:           os.Getenv("KAFKA_TLS_CERT_PATH"),
+		KafkaTlsKeyPath:            os.Getenv("KAFKA_TLS_KEY_PATH"),
+		KafkaTlsInsecureSkipVerify: os.Getenv("KAFKA_TLS_INSECURE_SKIP_VERIFY"),
+		KafkaSaslMechanism:         os.Getenv("KAFKA_SASL_MECHANISM"),
+		KafkaSaslUsername:          os.Getenv("KAFKA_SASL_USERNAME"),
+		KafkaSaslPassword:          os.Getenv("KAFKA_SASL_PASSWORD"),
+
+		SchemaRegistryPath: os.Getenv("SCHEMA_REGISTRY_PATH"),
+
+		LoadProfilePath: os.Getenv("LOAD_PROFILE_PATH"),
+
+		JourneysPath: os.Getenv("JOURNEYS_PATH"),
+
+		Seed: os.Getenv("SIMULATOR_SEED"),
 
-		KafkaRequestInterval: os.Getenv("KAFKA_REQUEST_INTERVAL"),
-		KafkaBrokerAddress:   os.Getenv("KAFKA_BROKER_ADDRESS"),
-		KafkaTopic:           os.Getenv("KAFKA_TOPIC"),
+		TrafficRecordPath:  os.Getenv("TRAFFIC_RECORD_PATH"),
+		TrafficReplayPath:  os.Getenv("TRAFFIC_REPLAY_PATH"),
+		TrafficReplaySpeed: os.Getenv("TRAFFIC_REPLAY_SPEED"),
 
 		Users: []string{
 			"elon",
@@ -41,5 +139,9 @@ func NewConfig() *SimulatorConfig {
 			"bill",
 			"mark",
 		},
+		UsersPath:         os.Getenv("USERS_PATH"),
+		UsersCount:        os.Getenv("USERS_COUNT"),
+		UsersDistribution: os.Getenv("USERS_DISTRIBUTION"),
+		UsersZipfExponent: os.Getenv("USERS_ZIPF_EXPONENT"),
 	}
 }
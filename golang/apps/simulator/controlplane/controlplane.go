@@ -0,0 +1,369 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/errormix"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/loadprofile"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ControlPlaneName = "simulator_control_plane"
+
+	ControlActionName    = "simulator.control.action"
+	ControlAction        = attribute.Key(ControlActionName)
+	ControlGeneratorName = "simulator.control.generator"
+	ControlGenerator     = attribute.Key(ControlGeneratorName)
+	ControlChangeName    = "simulator.control.change"
+	ControlChange        = attribute.Key(ControlChangeName)
+)
+
+// Wraps the load profile and lets operators retune the traffic at runtime
+type ControlPlane struct {
+	mu               sync.RWMutex
+	profile          *loadprofile.Profile
+	paused           map[string]bool
+	defaultRates     map[string]map[string]float64
+	rateOverrides    map[string]map[string]float64
+	errorMixOverride map[string]float64
+
+	tracer trace.Tracer
+}
+
+type State struct {
+	Profile          string                        `json:"profile"`
+	Phase            string                        `json:"phase"`
+	Paused           map[string]bool               `json:"paused"`
+	RateOverrides    map[string]map[string]float64 `json:"rateOverrides"`
+	ErrorMixOverride map[string]float64            `json:"errorMixOverride"`
+}
+
+// Create a control plane instance for the given profile
+func New(
+	profile *loadprofile.Profile,
+) *ControlPlane {
+	return &ControlPlane{
+		profile:      profile,
+		paused:       map[string]bool{},
+		defaultRates: map[string]map[string]float64{},
+		tracer:       otel.GetTracerProvider().Tracer(ControlPlaneName),
+	}
+}
+
+// Sets the rates of the given operations in every phase of the current &
+// of the later switched profiles which do not define them themselves
+func (c *ControlPlane) SetDefaultRates(
+	transport string,
+	rates map[string]float64,
+) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.defaultRates[transport] = rates
+	c.profile.SetDefaultRates(transport, rates)
+}
+
+// Returns the current rate of the operation considering the pauses
+// and the overrides
+func (c *ControlPlane) Rate(
+	transport string,
+	operation string,
+) float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.paused[transport] {
+		return 0
+	}
+	if rate, ok := c.rateOverrides[transport][operation]; ok {
+		return rate
+	}
+	return c.profile.Rate(transport, operation)
+}
+
+// Returns the overridden error mix or the one of the current phase
+func (c *ControlPlane) ErrorMix() map[string]float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.errorMixOverride != nil {
+		return c.errorMixOverride
+	}
+	return c.profile.ErrorMix()
+}
+
+// Returns the profile which is currently executed
+func (c *ControlPlane) CurrentProfile() *loadprofile.Profile {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.profile
+}
+
+// Returns the current state of the control plane
+func (c *ControlPlane) State() *State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	paused := make(map[string]bool, len(c.paused))
+	for generator, isPaused := range c.paused {
+		paused[generator] = isPaused
+	}
+
+	return &State{
+		Profile:          c.profile.Name,
+		Phase:            c.profile.CurrentPhase().Name,
+		Paused:           paused,
+		RateOverrides:    c.rateOverrides,
+		ErrorMixOverride: c.errorMixOverride,
+	}
+}
+
+// Control handler which returns the current state
+func (c *ControlPlane) Control(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	c.writeState(w)
+}
+
+// Pause handler which stops the given generator
+func (c *ControlPlane) Pause(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	c.setPaused(w, r, true)
+}
+
+// Resume handler which restarts the given generator
+func (c *ControlPlane) Resume(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	c.setPaused(w, r, false)
+}
+
+func (c *ControlPlane) setPaused(
+	w http.ResponseWriter,
+	r *http.Request,
+	isPaused bool,
+) {
+	action := "resume"
+	if isPaused {
+		action = "pause"
+	}
+
+	generator := r.URL.Query().Get("generator")
+	c.change(w, r, action, func(ctx context.Context, span trace.Span) error {
+		if generator != loadprofile.TransportHttp &&
+			generator != loadprofile.TransportKafka &&
+			generator != loadprofile.TransportJourney {
+			return fmt.Errorf("unknown generator %q", generator)
+		}
+		span.SetAttributes(ControlGenerator.String(generator))
+
+		c.mu.Lock()
+		c.paused[generator] = isPaused
+		c.mu.Unlock()
+
+		logger.Log(logrus.InfoLevel, ctx, "", "Generator "+generator+" is "+action+"d.")
+		return nil
+	})
+}
+
+// Rates handler which overrides the rates of the profile. An empty
+// body resets the overrides.
+func (c *ControlPlane) Rates(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	c.change(w, r, "rates", func(ctx context.Context, span trace.Span) error {
+		rates := map[string]map[string]float64{}
+		body, err := decode(r, &rates)
+		if err != nil {
+			return err
+		}
+		if err := c.validateRates(rates); err != nil {
+			return err
+		}
+		span.SetAttributes(ControlChange.String(body))
+
+		c.mu.Lock()
+		if len(rates) == 0 {
+			c.rateOverrides = nil
+		} else {
+			c.rateOverrides = rates
+		}
+		c.mu.Unlock()
+
+		logger.Log(logrus.InfoLevel, ctx, "", "Rates are overridden with "+body+".")
+		return nil
+	})
+}
+
+// Checks whether the rates are not negative & belong to the operations
+// which the generators run
+func (c *ControlPlane) validateRates(
+	rates map[string]map[string]float64,
+) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for transport, operations := range rates {
+		for operation, rate := range operations {
+			known := false
+			switch transport {
+			case loadprofile.TransportHttp:
+				known = operation == http.MethodGet || operation == http.MethodDelete
+			case loadprofile.TransportKafka:
+				known = operation == loadprofile.OperationPublish
+			case loadprofile.TransportJourney:
+				_, known = c.defaultRates[transport][operation]
+			default:
+				return fmt.Errorf("unknown transport %q", transport)
+			}
+			if !known {
+				return fmt.Errorf("unknown operation %q of transport %q", operation, transport)
+			}
+			if rate < 0 {
+				return fmt.Errorf("rate of %q of transport %q is negative", operation, transport)
+			}
+		}
+	}
+	return nil
+}
+
+// Errors handler which overrides the error mix of the profile. An
+// empty body resets the override.
+func (c *ControlPlane) Errors(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	c.change(w, r, "errors", func(ctx context.Context, span trace.Span) error {
+		errorMix := map[string]float64{}
+		body, err := decode(r, &errorMix)
+		if err != nil {
+			return err
+		}
+		if err := errormix.Validate(errorMix); err != nil {
+			return err
+		}
+		span.SetAttributes(ControlChange.String(body))
+
+		c.mu.Lock()
+		if len(errorMix) == 0 {
+			c.errorMixOverride = nil
+		} else {
+			c.errorMixOverride = errorMix
+		}
+		c.mu.Unlock()
+
+		logger.Log(logrus.InfoLevel, ctx, "", "Error mix is overridden with "+body+".")
+		return nil
+	})
+}
+
+// Profile handler which switches to the given load profile
+func (c *ControlPlane) Profile(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	c.change(w, r, "profile", func(ctx context.Context, span trace.Span) error {
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+
+		profile, err := loadprofile.Parse(content)
+		if err != nil {
+			return err
+		}
+		span.SetAttributes(ControlChange.String(profile.Name))
+
+		c.mu.Lock()
+		for transport, rates := range c.defaultRates {
+			profile.SetDefaultRates(transport, rates)
+		}
+		profile.Start()
+		c.profile = profile
+		c.mu.Unlock()
+
+		logger.Log(logrus.InfoLevel, ctx, "", "Load profile is switched to "+profile.Name+".")
+		return nil
+	})
+}
+
+// Applies a change within its own span and responds with the new state
+func (c *ControlPlane) change(
+	w http.ResponseWriter,
+	r *http.Request,
+	action string,
+	apply func(context.Context, trace.Span) error,
+) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, span := c.tracer.Start(r.Context(), "control "+action,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(ControlAction.String(action)),
+	)
+	defer span.End()
+
+	if err := apply(ctx, span); err != nil {
+		logger.Log(logrus.ErrorLevel, ctx, "", "Control "+action+" is failed: "+err.Error())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	c.writeState(w)
+}
+
+func (c *ControlPlane) writeState(
+	w http.ResponseWriter,
+) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c.State())
+}
+
+// Decodes the optional JSON body and returns it as string
+func decode(
+	r *http.Request,
+	v any,
+) (
+	string,
+	error,
+) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	if len(body) == 0 {
+		return "{}", nil
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
@@ -0,0 +1,133 @@
+package controlplane
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/loadprofile"
+)
+
+func Test_GeneratorPausedAndResumed(t *testing.T) {
+	profile := loadprofile.NewDefault(1000, 1000)
+	profile.Start()
+	c := New(profile)
+
+	rec := httptest.NewRecorder()
+	c.Pause(rec, httptest.NewRequest(http.MethodPost, "/control/pause?generator=http", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d.", rec.Code)
+	}
+	if c.Rate(loadprofile.TransportHttp, http.MethodGet) != 0 {
+		t.Error("Paused generator should have no traffic.")
+	}
+	if c.Rate(loadprofile.TransportKafka, loadprofile.OperationPublish) != 1 {
+		t.Error("Other generators should not be affected.")
+	}
+
+	rec = httptest.NewRecorder()
+	c.Resume(rec, httptest.NewRequest(http.MethodPost, "/control/resume?generator=http", nil))
+	if c.Rate(loadprofile.TransportHttp, http.MethodGet) != 1 {
+		t.Error("Resumed generator should have traffic again.")
+	}
+}
+
+func Test_RatesAndErrorsOverridden(t *testing.T) {
+	profile := loadprofile.NewDefault(1000, 1000)
+	profile.Start()
+	c := New(profile)
+
+	rec := httptest.NewRecorder()
+	c.Rates(rec, httptest.NewRequest(http.MethodPost, "/control/rates",
+		strings.NewReader(`{"http": {"GET": 20}}`)))
+	if c.Rate(loadprofile.TransportHttp, http.MethodGet) != 20 {
+		t.Error("Rate is not overridden.")
+	}
+
+	rec = httptest.NewRecorder()
+	c.Errors(rec, httptest.NewRequest(http.MethodPost, "/control/errors",
+		strings.NewReader(`{"databaseConnectionError": 0.5}`)))
+	if c.ErrorMix()["databaseConnectionError"] != 0.5 {
+		t.Error("Error mix is not overridden.")
+	}
+
+	// Empty body resets the overrides
+	rec = httptest.NewRecorder()
+	c.Rates(rec, httptest.NewRequest(http.MethodPost, "/control/rates", nil))
+	if c.Rate(loadprofile.TransportHttp, http.MethodGet) != 1 {
+		t.Error("Rate override is not reset.")
+	}
+}
+
+func Test_InvalidRatesRejected(t *testing.T) {
+	profile := loadprofile.NewDefault(1000, 1000)
+	profile.Start()
+	c := New(profile)
+	c.SetDefaultRates(loadprofile.TransportJourney, map[string]float64{"checkout": 1})
+
+	for _, body := range []string{
+		`{"http": {"GET": -1}}`,
+		`{"http": {"POST": 1}}`,
+		`{"kafka": {"consume": 1}}`,
+		`{"journey": {"signup": 1}}`,
+		`{"grpc": {"GET": 1}}`,
+	} {
+		rec := httptest.NewRecorder()
+		c.Rates(rec, httptest.NewRequest(http.MethodPost, "/control/rates", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code 400, got %d.", body, rec.Code)
+		}
+	}
+	if c.State().RateOverrides != nil {
+		t.Error("Invalid rates should not be stored.")
+	}
+
+	rec := httptest.NewRecorder()
+	c.Rates(rec, httptest.NewRequest(http.MethodPost, "/control/rates",
+		strings.NewReader(`{"journey": {"checkout": 2}}`)))
+	if rec.Code != http.StatusOK || c.Rate(loadprofile.TransportJourney, "checkout") != 2 {
+		t.Error("Rate of a known journey should be overridden.")
+	}
+}
+
+func Test_ProfileSwitched(t *testing.T) {
+	profile := loadprofile.NewDefault(1000, 1000)
+	profile.Start()
+	c := New(profile)
+
+	rec := httptest.NewRecorder()
+	c.Profile(rec, httptest.NewRequest(http.MethodPost, "/control/profile",
+		strings.NewReader(`{"name": "quiet", "phases": [{"type": "pause", "duration": "1m"}]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d.", rec.Code)
+	}
+	if c.CurrentProfile().Name != "quiet" {
+		t.Error("Profile is not switched.")
+	}
+
+	// Invalid profiles are rejected
+	rec = httptest.NewRecorder()
+	c.Profile(rec, httptest.NewRequest(http.MethodPost, "/control/profile",
+		strings.NewReader(`{"phases": []}`)))
+	if rec.Code != http.StatusBadRequest || c.CurrentProfile().Name != "quiet" {
+		t.Error("Invalid profile should be rejected.")
+	}
+}
+
+func Test_DefaultRatesKeptAfterProfileSwitch(t *testing.T) {
+	profile := loadprofile.NewDefault(1000, 1000)
+	profile.Start()
+	c := New(profile)
+	c.SetDefaultRates(loadprofile.TransportJourney, map[string]float64{"checkout": 2})
+
+	rec := httptest.NewRecorder()
+	c.Profile(rec, httptest.NewRequest(http.MethodPost, "/control/profile",
+		strings.NewReader(`{"name": "busy", "phases": [{"type": "steady", "duration": "1m", "rates": {"http": {"GET": 5}}}]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d.", rec.Code)
+	}
+	if c.Rate(loadprofile.TransportJourney, "checkout") != 2 {
+		t.Error("Default rates should apply to the switched profile.")
+	}
+}
@@ -0,0 +1,171 @@
+package errormix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DatabaseConnectionError      = "databaseConnectionError"
+	TableDoesNotExistError       = "tableDoesNotExistError"
+	PreprocessingException       = "preprocessingException"
+	SchemaNotFoundInCacheWarning = "schemaNotFoundInCacheWarning"
+
+	// Separates the faults of a combination (e.g. "a+b")
+	CombinationSeparator = "+"
+
+	SimulatorFaultsName = "simulator.faults"
+	SimulatorFaults     = attribute.Key(SimulatorFaultsName)
+)
+
+// Faults which the HTTP server knows how to cause
+var Faults = []string{
+	DatabaseConnectionError,
+	TableDoesNotExistError,
+	PreprocessingException,
+	SchemaNotFoundInCacheWarning,
+}
+
+// Returns the mix which causes each fault in 1 of 15 requests
+func Default() map[string]float64 {
+	mix := make(map[string]float64, len(Faults))
+	for _, fault := range Faults {
+		mix[fault] = 1.0 / 15
+	}
+	return mix
+}
+
+// Parses the mix out of the given JSON object which maps a fault or a
+// combination of faults to its probability per request
+func Parse(
+	value string,
+) (
+	map[string]float64,
+	error,
+) {
+	mix := map[string]float64{}
+	if err := json.Unmarshal([]byte(value), &mix); err != nil {
+		return nil, err
+	}
+
+	if err := Validate(mix); err != nil {
+		return nil, err
+	}
+	return mix, nil
+}
+
+// Checks whether the mix consists of known faults & valid probabilities
+func Validate(
+	mix map[string]float64,
+) error {
+	for entry, probability := range mix {
+		if probability < 0 || probability > 1 {
+			return fmt.Errorf("probability of %q is not between 0 and 1", entry)
+		}
+		for _, fault := range strings.Split(entry, CombinationSeparator) {
+			if !isKnown(fault) {
+				return fmt.Errorf("unknown fault %q", fault)
+			}
+		}
+	}
+	return nil
+}
+
+// Draws the faults of a request. Every entry of the mix is drawn
+// independently so that several faults can be caused together.
+func Draw(
+	randomizer *rand.Rand,
+	mix map[string]float64,
+) []string {
+
+	// Iterate in a fixed order to keep the draws reproducible
+	entries := make([]string, 0, len(mix))
+	for entry := range mix {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	faults := []string{}
+	for _, entry := range entries {
+		if randomizer.Float64() >= mix[entry] {
+			continue
+		}
+		for _, fault := range strings.Split(entry, CombinationSeparator) {
+			if !contains(faults, fault) {
+				faults = append(faults, fault)
+			}
+		}
+	}
+
+	sort.Strings(faults)
+	return faults
+}
+
+// Draws any single fault
+func DrawAny(
+	randomizer *rand.Rand,
+) string {
+	return Faults[randomizer.Intn(len(Faults))]
+}
+
+func isKnown(
+	fault string,
+) bool {
+	return contains(Faults, fault)
+}
+
+func contains(
+	faults []string,
+	fault string,
+) bool {
+	for _, f := range faults {
+		if f == fault {
+			return true
+		}
+	}
+	return false
+}
+
+type faultsKey struct{}
+
+// Puts the intended faults of a request into the context so that they
+// are recorded on its client spans
+func ContextWithFaults(
+	ctx context.Context,
+	faults []string,
+) context.Context {
+	return context.WithValue(ctx, faultsKey{}, faults)
+}
+
+// Adds the intended faults of the context to every started client span
+type spanProcessor struct{}
+
+func NewSpanProcessor() sdktrace.SpanProcessor {
+	return &spanProcessor{}
+}
+
+func (p *spanProcessor) OnStart(
+	ctx context.Context,
+	span sdktrace.ReadWriteSpan,
+) {
+	if span.SpanKind() != trace.SpanKindClient {
+		return
+	}
+	if faults, ok := ctx.Value(faultsKey{}).([]string); ok {
+		span.SetAttributes(SimulatorFaults.StringSlice(faults))
+	}
+}
+
+func (p *spanProcessor) OnEnd(_ sdktrace.ReadOnlySpan) {}
+
+func (p *spanProcessor) Shutdown(_ context.Context) error { return nil }
+
+func (p *spanProcessor) ForceFlush(_ context.Context) error { return nil }
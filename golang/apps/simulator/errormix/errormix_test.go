@@ -0,0 +1,124 @@
+package errormix
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func Test_MixParsed(t *testing.T) {
+	mix, err := Parse(`{"databaseConnectionError": 0.1, "preprocessingException+schemaNotFoundInCacheWarning": 0.05}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mix) != 2 {
+		t.Errorf("Expected 2 entries, got %d.", len(mix))
+	}
+
+	if _, err := Parse(`{"unknownError": 0.1}`); err == nil {
+		t.Error("Unknown fault should be rejected.")
+	}
+	if _, err := Parse(`{"databaseConnectionError+unknownError": 0.1}`); err == nil {
+		t.Error("Unknown fault in a combination should be rejected.")
+	}
+	if _, err := Parse(`{"databaseConnectionError": 1.5}`); err == nil {
+		t.Error("Probability above 1 should be rejected.")
+	}
+}
+
+func Test_FaultsDrawnWithTheirProbabilities(t *testing.T) {
+	mix := map[string]float64{
+		DatabaseConnectionError: 0.2,
+		PreprocessingException + CombinationSeparator + SchemaNotFoundInCacheWarning: 0.1,
+	}
+
+	randomizer := rand.New(rand.NewSource(42))
+	counts := map[string]int{}
+	combined := 0
+	draws := 10000
+	for i := 0; i < draws; i++ {
+		faults := Draw(randomizer, mix)
+		for _, fault := range faults {
+			counts[fault]++
+		}
+		if len(faults) > 1 {
+			combined++
+		}
+	}
+
+	assertRate(t, DatabaseConnectionError, counts[DatabaseConnectionError], draws, 0.2)
+	assertRate(t, PreprocessingException, counts[PreprocessingException], draws, 0.1)
+	if counts[PreprocessingException] != counts[SchemaNotFoundInCacheWarning] {
+		t.Error("Faults of a combination should always be caused together.")
+	}
+	if counts[TableDoesNotExistError] != 0 {
+		t.Error("Faults out of the mix should not be caused.")
+	}
+	if combined == 0 {
+		t.Error("Several faults should be caused together.")
+	}
+}
+
+func Test_DrawsReproducible(t *testing.T) {
+	first := rand.New(rand.NewSource(42))
+	second := rand.New(rand.NewSource(42))
+	for i := 0; i < 100; i++ {
+		a := strings.Join(Draw(first, Default()), ",")
+		b := strings.Join(Draw(second, Default()), ",")
+		if a != b {
+			t.Fatal("Same seed should draw the same faults.")
+		}
+	}
+}
+
+func Test_FaultsAddedToClientSpans(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(NewSpanProcessor()),
+		sdktrace.WithSpanProcessor(sr),
+	)
+	tracer := tp.Tracer("test")
+
+	ctx := ContextWithFaults(context.Background(), []string{DatabaseConnectionError})
+	_, client := tracer.Start(ctx, "client", trace.WithSpanKind(trace.SpanKindClient))
+	client.End()
+	_, internal := tracer.Start(ctx, "internal", trace.WithSpanKind(trace.SpanKindInternal))
+	internal.End()
+
+	spans := sr.Ended()
+	if !hasFaults(spans[0]) {
+		t.Error("Client span should have the intended faults.")
+	}
+	if hasFaults(spans[1]) {
+		t.Error("Internal span should not have the intended faults.")
+	}
+}
+
+func assertRate(
+	t *testing.T,
+	fault string,
+	count int,
+	draws int,
+	expected float64,
+) {
+	rate := float64(count) / float64(draws)
+	if rate < expected-0.02 || rate > expected+0.02 {
+		t.Errorf("Expected rate of %s to be around %.2f, got %.3f.", fault, expected, rate)
+	}
+}
+
+func hasFaults(
+	span sdktrace.ReadOnlySpan,
+) bool {
+	for _, attr := range span.Attributes() {
+		if attr.Key == SimulatorFaults {
+			return true
+		}
+	}
+	return false
+}
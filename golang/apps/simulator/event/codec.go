@@ -0,0 +1,196 @@
+package event
+
+import (
+	"context"
+	"errors"
+
+	semconv "github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	CodecName = "event_codec"
+
+	OperationEncode = "encode"
+	OperationDecode = "decode"
+
+	EventCodecFailuresName = "event.codec.failures"
+
+	EventIdName        = "event.id"
+	EventId            = attribute.Key(EventIdName)
+	EventTypeName      = "event.type"
+	EventType          = attribute.Key(EventTypeName)
+	EventVersionName   = "event.version"
+	EventVersion       = attribute.Key(EventVersionName)
+	EventEncodingName  = "event.encoding"
+	EventEncoding      = attribute.Key(EventEncodingName)
+	EventOperationName = "event.operation"
+	EventOperation     = attribute.Key(EventOperationName)
+)
+
+// Encodes & decodes the envelopes while validating them against the
+// registry. Every failure is recorded on its span & counted.
+type Codec struct {
+	Registry *Registry
+	Encoding string
+
+	tracer   trace.Tracer
+	failures metric.Int64Counter
+}
+
+// Creates a codec which encodes with the given encoding
+func NewCodec(
+	registry *Registry,
+	encoding string,
+) *Codec {
+	if err := ValidateEncoding(encoding); err != nil {
+		panic(err)
+	}
+
+	// Instantiate trace provider
+	tracer := otel.GetTracerProvider().Tracer(CodecName)
+
+	// Instantiate meter provider
+	meter := otel.GetMeterProvider().Meter(CodecName)
+
+	// Create codec failures counter
+	failures, err := meter.Int64Counter(
+		EventCodecFailuresName,
+		metric.WithUnit("{event}"),
+		metric.WithDescription("Number of events which could not be encoded or decoded"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Codec{
+		Registry: registry,
+		Encoding: encoding,
+
+		tracer:   tracer,
+		failures: failures,
+	}
+}
+
+// Validates & encodes the envelope. Returns the encoded value and its
+// content type.
+func (c *Codec) Encode(
+	ctx context.Context,
+	envelope *Envelope,
+) (
+	[]byte,
+	string,
+	error,
+) {
+	attrs := []attribute.KeyValue{
+		EventOperation.String(OperationEncode),
+		EventEncoding.String(c.Encoding),
+		EventType.String(envelope.Type),
+		EventVersion.Int(envelope.Version),
+	}
+	ctx, span := c.tracer.Start(
+		ctx,
+		"event "+OperationEncode,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(append(attrs, EventId.String(envelope.Id))...),
+	)
+	defer span.End()
+
+	if err := c.Registry.Validate(envelope); err != nil {
+		c.fail(ctx, span, attrs, err)
+		return nil, "", err
+	}
+
+	value, err := Marshal(envelope, c.Encoding)
+	if err != nil {
+		c.fail(ctx, span, attrs, err)
+		return nil, "", err
+	}
+
+	contentType, _ := ContentTypeOf(c.Encoding)
+	return value, contentType, nil
+}
+
+// Decodes the value according to its content type & validates it
+func (c *Codec) Decode(
+	ctx context.Context,
+	value []byte,
+	contentType string,
+) (
+	*Envelope,
+	error,
+) {
+	ctx, span := c.tracer.Start(
+		ctx,
+		"event "+OperationDecode,
+		trace.WithSpanKind(trace.SpanKindInternal),
+	)
+	defer span.End()
+
+	attrs := []attribute.KeyValue{
+		EventOperation.String(OperationDecode),
+	}
+
+	encoding, err := EncodingOf(contentType)
+	if err != nil {
+		c.fail(ctx, span, attrs, err)
+		return nil, err
+	}
+	attrs = append(attrs, EventEncoding.String(encoding))
+
+	envelope, err := Unmarshal(value, encoding)
+	if err != nil {
+		c.fail(ctx, span, attrs, err)
+		return nil, err
+	}
+	attrs = append(attrs,
+		EventType.String(envelope.Type),
+		EventVersion.Int(envelope.Version),
+	)
+	span.SetAttributes(EventId.String(envelope.Id))
+
+	if err := c.Registry.Validate(envelope); err != nil {
+		c.fail(ctx, span, attrs, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attrs...)
+	return envelope, nil
+}
+
+// Records the failure on the span & counts it
+func (c *Codec) fail(
+	ctx context.Context,
+	span trace.Span,
+	attrs []attribute.KeyValue,
+	err error,
+) {
+	attrs = append(attrs, semconv.ErrorType.String(ErrorType(err)))
+	c.failures.Add(ctx, 1, metric.WithAttributes(attrs...))
+
+	span.SetAttributes(attrs...)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Returns a low cardinality type of the codec error
+func ErrorType(
+	err error,
+) string {
+	switch {
+	case errors.Is(err, ErrUnknownSchema):
+		return "unknown_schema"
+	case errors.Is(err, ErrSchemaMismatch):
+		return "schema_mismatch"
+	case errors.Is(err, ErrUnsupportedEncoding):
+		return "unsupported_encoding"
+	case errors.Is(err, ErrMalformed):
+		return "malformed"
+	default:
+		return "encoding"
+	}
+}
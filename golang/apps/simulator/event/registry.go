@@ -0,0 +1,155 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+var (
+	ErrUnknownSchema  = errors.New("unknown schema")
+	ErrSchemaMismatch = errors.New("schema mismatch")
+)
+
+// Field of an event payload
+type Field struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+}
+
+// Payload fields of a version of an event type
+type Schema struct {
+	Type    string  `json:"type"`
+	Version int     `json:"version"`
+	Fields  []Field `json:"fields"`
+}
+
+// Local stand-in of a schema registry which knows the schemas of the
+// event types & their versions
+type Registry struct {
+	schemas map[string]map[int]*Schema
+}
+
+// Returns the registry with the built-in versions of the user created
+// event
+func DefaultRegistry() *Registry {
+	registry, err := NewRegistry([]*Schema{
+		{
+			Type:    TypeUserCreated,
+			Version: 1,
+			Fields: []Field{
+				{Name: "name", Required: true},
+			},
+		},
+		{
+			Type:    TypeUserCreated,
+			Version: 2,
+			Fields: []Field{
+				{Name: "name", Required: true},
+				{Name: "tier"},
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// Creates a registry out of the given schemas
+func NewRegistry(
+	schemas []*Schema,
+) (
+	*Registry,
+	error,
+) {
+	r := &Registry{
+		schemas: map[string]map[int]*Schema{},
+	}
+	for _, schema := range schemas {
+		if schema.Type == "" {
+			return nil, errors.New("schema has no type")
+		}
+		if schema.Version < 1 {
+			return nil, fmt.Errorf("version of schema %q must be at least 1", schema.Type)
+		}
+		if _, ok := r.schemas[schema.Type]; !ok {
+			r.schemas[schema.Type] = map[int]*Schema{}
+		}
+		if _, ok := r.schemas[schema.Type][schema.Version]; ok {
+			return nil, fmt.Errorf("schema %q version %d is defined twice", schema.Type, schema.Version)
+		}
+		r.schemas[schema.Type][schema.Version] = schema
+	}
+	return r, nil
+}
+
+// Loads the registry out of a JSON file which contains a list of schemas
+func LoadRegistry(
+	path string,
+) (
+	*Registry,
+	error,
+) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := []*Schema{}
+	if err := json.Unmarshal(content, &schemas); err != nil {
+		return nil, err
+	}
+	return NewRegistry(schemas)
+}
+
+// Returns the latest version of the event type
+func (r *Registry) Latest(
+	eventType string,
+) (
+	*Schema,
+	error,
+) {
+	versions, ok := r.schemas[eventType]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSchema, eventType)
+	}
+
+	latest := make([]int, 0, len(versions))
+	for version := range versions {
+		latest = append(latest, version)
+	}
+	sort.Ints(latest)
+	return versions[latest[len(latest)-1]], nil
+}
+
+// Checks whether the envelope is complete & its payload matches the
+// schema of its type & version
+func (r *Registry) Validate(
+	envelope *Envelope,
+) error {
+	if envelope.Id == "" || envelope.Type == "" || envelope.Timestamp.IsZero() {
+		return fmt.Errorf("%w: envelope requires id, type & timestamp", ErrSchemaMismatch)
+	}
+
+	schema, ok := r.schemas[envelope.Type][envelope.Version]
+	if !ok {
+		return fmt.Errorf("%w %q version %d", ErrUnknownSchema, envelope.Type, envelope.Version)
+	}
+
+	known := make(map[string]bool, len(schema.Fields))
+	for _, field := range schema.Fields {
+		known[field.Name] = true
+		if _, ok := envelope.Payload[field.Name]; field.Required && !ok {
+			return fmt.Errorf("%w: %q version %d requires field %q", ErrSchemaMismatch, envelope.Type, envelope.Version, field.Name)
+		}
+	}
+	for name := range envelope.Payload {
+		if !known[name] {
+			return fmt.Errorf("%w: %q version %d has no field %q", ErrSchemaMismatch, envelope.Type, envelope.Version, name)
+		}
+	}
+	return nil
+}
@@ -7,29 +7,42 @@ import (
 	"io"
 	"math/rand"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/errormix"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/loadprofile"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/logger"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/population"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/scheduler"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/seed"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/stats"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/traffic"
 
 	otelhttp "github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel/http"
 )
 
-var (
-	randomErrors = map[int]string{
-		1: "databaseConnectionError",
-		2: "tableDoesNotExistError",
-		3: "preprocessingException",
-		4: "schemaNotFoundInCacheWarning",
-	}
-)
-
 type Opts struct {
 	ServiceName     string
 	RequestInterval int64
 	ServerEndpoint  string
 	ServerPort      string
+	RetryAttempts   int64
+	RetryBackoff    int64
+	RetryMaxBackoff int64
+	ConnTracing     string
+	ErrorMix        map[string]float64
+	LoadProfile     loadprofile.Shape
+	MaxVirtualUsers int64
+	Stats           *stats.Recorder
+	Traffic         *traffic.Recorder
+	Seed            int64
+
+	CircuitBreakerThreshold   float64
+	CircuitBreakerMinRequests int64
+	CircuitBreakerCoolDown    int64
 }
 
 type OptFunc func(*Opts)
@@ -39,13 +52,21 @@ func defaultOpts() *Opts {
 		RequestInterval: 2000,
 		ServerEndpoint:  "httpserver",
 		ServerPort:      "8080",
+		RetryAttempts:   1,
+		RetryBackoff:    100,
+		RetryMaxBackoff: 5000,
+		ErrorMix:        errormix.Default(),
+		MaxVirtualUsers: 50,
+		Seed:            time.Now().UnixNano(),
+
+		CircuitBreakerMinRequests: 10,
+		CircuitBreakerCoolDown:    5000,
 	}
 }
 
 type HttpServerSimulator struct {
-	Opts       *Opts
-	Client     *otelhttp.HttpClient
-	Randomizer *rand.Rand
+	Opts   *Opts
+	Client *otelhttp.HttpClient
 }
 
 // Create an HTTP server simulator instance
@@ -61,16 +82,38 @@ func New(
 		f(opts)
 	}
 
-	httpClient := otelhttp.New(
+	// Run the request interval forever if no load profile is given
+	if opts.LoadProfile == nil {
+		profile := loadprofile.NewDefault(opts.RequestInterval, opts.RequestInterval)
+		profile.Start()
+		opts.LoadProfile = profile
+	}
+
+	clientOpts := []otelhttp.OptFunc{
 		otelhttp.WithTimeout(time.Duration(10 * time.Second)),
-	)
+		otelhttp.WithRetryPolicy(
+			int(opts.RetryAttempts),
+			time.Duration(opts.RetryBackoff)*time.Millisecond,
+			time.Duration(opts.RetryMaxBackoff)*time.Millisecond,
+		),
+		otelhttp.WithConnectionTracing(otelhttp.ConnectionTracing(opts.ConnTracing)),
+		otelhttp.WithSeed(opts.Seed),
+	}
 
-	randomizer := rand.New(rand.NewSource(time.Now().UnixNano()))
+	// Circuit breaker is only enabled when its threshold is given
+	if opts.CircuitBreakerThreshold > 0 {
+		clientOpts = append(clientOpts, otelhttp.WithCircuitBreaker(
+			opts.CircuitBreakerThreshold,
+			int(opts.CircuitBreakerMinRequests),
+			time.Duration(opts.CircuitBreakerCoolDown)*time.Millisecond,
+		))
+	}
+
+	httpClient := otelhttp.New(clientOpts...)
 
 	return &HttpServerSimulator{
-		Opts:       opts,
-		Client:     httpClient,
-		Randomizer: randomizer,
+		Opts:   opts,
+		Client: httpClient,
 	}
 }
 
@@ -106,67 +149,318 @@ func WithServerPort(serverPort string) OptFunc {
 	}
 }
 
+// Configure load profile which determines the rates & errors of the HTTP calls
+func WithLoadProfile(shape loadprofile.Shape) OptFunc {
+	return func(opts *Opts) {
+		opts.LoadProfile = shape
+	}
+}
+
+// Configure error mix in JSON which is used if neither the user nor the
+// phase defines one (e.g. {"databaseConnectionError": 0.05,
+// "preprocessingException+schemaNotFoundInCacheWarning": 0.01})
+func WithErrorMix(errorMix string) OptFunc {
+	if errorMix == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := errormix.Parse(errorMix)
+	if err != nil {
+		panic(err.Error())
+	}
+	return func(opts *Opts) {
+		opts.ErrorMix = parsed
+	}
+}
+
+// Configure seed of the user selection, error injection & retry jitter
+func WithSeed(seed int64) OptFunc {
+	return func(opts *Opts) {
+		opts.Seed = seed
+	}
+}
+
+// Configure recorder which aggregates the outcome of the HTTP calls
+func WithStatsRecorder(recorder *stats.Recorder) OptFunc {
+	return func(opts *Opts) {
+		opts.Stats = recorder
+	}
+}
+
+// Configure recorder which writes every HTTP call into a file for replay
+func WithTrafficRecorder(recorder *traffic.Recorder) OptFunc {
+	return func(opts *Opts) {
+		opts.Traffic = recorder
+	}
+}
+
+// Configure max number of concurrent HTTP calls per method
+func WithMaxVirtualUsers(maxVirtualUsers string) OptFunc {
+	return withOptionalInt(maxVirtualUsers, "max virtual users", 1, func(opts *Opts, value int64) {
+		opts.MaxVirtualUsers = value
+	})
+}
+
+// Configure max number of attempts per HTTP call (1 disables retries)
+func WithRetryAttempts(retryAttempts string) OptFunc {
+	return withOptionalInt(retryAttempts, "retry attempts", 0, func(opts *Opts, value int64) {
+		opts.RetryAttempts = value
+	})
+}
+
+// Configure initial backoff between retries in milliseconds
+func WithRetryBackoff(retryBackoff string) OptFunc {
+	return withOptionalInt(retryBackoff, "retry backoff", 0, func(opts *Opts, value int64) {
+		opts.RetryBackoff = value
+	})
+}
+
+// Configure max backoff between retries in milliseconds
+func WithRetryMaxBackoff(retryMaxBackoff string) OptFunc {
+	return withOptionalInt(retryMaxBackoff, "retry max backoff", 0, func(opts *Opts, value int64) {
+		opts.RetryMaxBackoff = value
+	})
+}
+
+// Configure connection level tracing of HTTP calls ("", events or spans)
+func WithConnectionTracing(connTracing string) OptFunc {
+	switch otelhttp.ConnectionTracing(connTracing) {
+	case otelhttp.ConnectionTracingNone,
+		otelhttp.ConnectionTracingEvents,
+		otelhttp.ConnectionTracingSpans:
+	default:
+		panic("unknown connection tracing mode: " + connTracing)
+	}
+	return func(opts *Opts) {
+		opts.ConnTracing = connTracing
+	}
+}
+
+// Configure failure rate (0-1) above which the circuit breaker opens
+func WithCircuitBreakerThreshold(threshold string) OptFunc {
+	if threshold == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.ParseFloat(threshold, 64)
+	if err != nil {
+		panic(err.Error())
+	}
+	return func(opts *Opts) {
+		opts.CircuitBreakerThreshold = parsed
+	}
+}
+
+// Configure min number of calls before the circuit breaker evaluates the failure rate
+func WithCircuitBreakerMinRequests(minRequests string) OptFunc {
+	return withOptionalInt(minRequests, "circuit breaker min requests", 0, func(opts *Opts, value int64) {
+		opts.CircuitBreakerMinRequests = value
+	})
+}
+
+// Configure cool down of the open circuit breaker in milliseconds
+func WithCircuitBreakerCoolDown(coolDown string) OptFunc {
+	return withOptionalInt(coolDown, "circuit breaker cool down", 0, func(opts *Opts, value int64) {
+		opts.CircuitBreakerCoolDown = value
+	})
+}
+
+// Parses an optional integer option which must be at least the given
+// minimum and keeps the default if it is not set
+func withOptionalInt(
+	value string,
+	name string,
+	minimum int64,
+	set func(*Opts, int64),
+) OptFunc {
+	if value == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		panic(err.Error())
+	}
+	if parsed < minimum {
+		panic(name + " must be at least " + strconv.FormatInt(minimum, 10))
+	}
+	return func(opts *Opts) {
+		set(opts, parsed)
+	}
+}
+
 // Starts simulating HTTP server
 func (h *HttpServerSimulator) Simulate(
-	users []string,
+	users *population.Population,
 ) {
 
 	// LIST simulator
-	go func() {
-		for {
-
-			// Make request after each interval
-			time.Sleep(time.Duration(h.Opts.RequestInterval) * time.Millisecond)
-
-			// List
-			h.performHttpCall(
-				context.Background(),
-				http.MethodGet,
-				users[h.Randomizer.Intn(len(users))],
-				h.causeRandomError(),
-			)
-		}
-	}()
+	go h.simulate(http.MethodGet, users)
 
 	// DELETE simulator
-	go func() {
-		for {
-
-			// Make request after each interval * 4
-			time.Sleep(4 * time.Duration(h.Opts.RequestInterval) * time.Millisecond)
-
-			// Delete
-			h.performHttpCall(
-				context.Background(),
-				http.MethodDelete,
-				users[h.Randomizer.Intn(len(users))],
-				h.causeRandomError(),
-			)
+	go h.simulate(http.MethodDelete, users)
+}
+
+// Keeps performing the HTTP calls of the given method with the rate
+// of the current load profile phase on a fixed schedule
+func (h *HttpServerSimulator) simulate(
+	httpMethod string,
+	users *population.Population,
+) {
+	// Each method draws its own reproducible sequence
+	randomizer := seed.NewRandomizer(h.Opts.Seed, loadprofile.TransportHttp+" "+httpMethod)
+
+	s := scheduler.New(
+		func() float64 {
+			return h.Opts.LoadProfile.Rate(loadprofile.TransportHttp, httpMethod)
+		},
+		func() scheduler.IterationFunc {
+			user, reqParams := h.randomizeCall(randomizer, users)
+
+			// The retry jitter of the call is drawn from its own
+			// randomizer to keep it independent of the other calls
+			jitter := rand.New(rand.NewSource(randomizer.Int63()))
+			return func(ctx context.Context) error {
+				ctx = otelhttp.ContextWithJitterRandomizer(ctx, jitter)
+				return h.call(ctx, httpMethod, user, reqParams)
+			}
+		},
+		scheduler.WithOperation(loadprofile.TransportHttp+" "+httpMethod),
+		scheduler.WithMaxVirtualUsers(int(h.Opts.MaxVirtualUsers)),
+	)
+
+	s.Run(context.Background())
+}
+
+// Re-issues the recorded HTTP calls with their original timing relative
+// to the origin at the given speed
+func (h *HttpServerSimulator) Replay(
+	entries []*traffic.Entry,
+	origin time.Time,
+	speed float64,
+) {
+	traffic.Replay(entries, origin, speed, func(entry *traffic.Entry) {
+		user := &population.User{
+			Id:   entry.User,
+			Tier: entry.Tier,
 		}
-	}()
+		h.call(context.Background(), entry.Operation, user, entry.Params)
+	})
+}
+
+// Performs the HTTP call on behalf of the user and records its outcome
+func (h *HttpServerSimulator) call(
+	ctx context.Context,
+	httpMethod string,
+	user *population.User,
+	reqParams map[string]string,
+) error {
+	ctx = population.ContextWithUser(ctx, user)
+	ctx = errormix.ContextWithFaults(ctx, faultsOf(reqParams))
+
+	callStartTime := time.Now()
+	_, err := h.performHttpCall(ctx, httpMethod, user.Id, reqParams)
+	elapsedTime := time.Since(callStartTime)
+
+	h.Opts.Stats.Record(loadprofile.TransportHttp, httpMethod, elapsedTime, err)
+	h.Opts.Traffic.Record(&traffic.Entry{
+		Timestamp: callStartTime,
+		Transport: loadprofile.TransportHttp,
+		Operation: httpMethod,
+		User:      user.Id,
+		Tier:      user.Tier,
+		Params:    reqParams,
+		Duration:  float64(elapsedTime) / float64(time.Millisecond),
+	}, err)
+	return err
+}
+
+// Performs a single HTTP call with the given request params but without
+// any errors on behalf of the user within the given context and returns
+// the response body
+func (h *HttpServerSimulator) Call(
+	ctx context.Context,
+	httpMethod string,
+	user *population.User,
+	reqParams map[string]string,
+) (
+	[]byte,
+	error,
+) {
+	ctx = population.ContextWithUser(ctx, user)
+	ctx = errormix.ContextWithFaults(ctx, []string{})
+
+	callStartTime := time.Now()
+	resBody, err := h.performHttpCall(ctx, httpMethod, user.Id, reqParams)
+	h.Opts.Stats.Record(loadprofile.TransportHttp, httpMethod, time.Since(callStartTime), err)
+	return resBody, err
+}
+
+// Picks a random user and random errors for the next call
+func (h *HttpServerSimulator) randomizeCall(
+	randomizer *rand.Rand,
+	users *population.Population,
+) (
+	*population.User,
+	map[string]string,
+) {
+	user := users.Pick(randomizer)
+	return user, h.causeRandomError(randomizer, user)
 }
 
-// Puts necessary request parameters into a map in order to
-// cause a random error
-func (h *HttpServerSimulator) causeRandomError() map[string]string {
+// Draws the faults of the next call and puts them into the request
+// params in order to cause them on the HTTP server
+func (h *HttpServerSimulator) causeRandomError(
+	randomizer *rand.Rand,
+	user *population.User,
+) map[string]string {
 
-	randomNum := h.Randomizer.Intn(15)
 	reqParams := map[string]string{}
+	for _, fault := range h.drawFaults(randomizer, user) {
+		reqParams[fault] = "true"
+	}
+	return reqParams
+}
 
-	if randomNum == 1 || randomNum == 2 || randomNum == 3 || randomNum == 4 {
-		reqParams[randomErrors[randomNum]] = "true"
+// Error prone users cause any of the faults on top of the error mix.
+// Otherwise the faults are drawn from the error mix of the user, the
+// one of the phase or the configured one in this order.
+func (h *HttpServerSimulator) drawFaults(
+	randomizer *rand.Rand,
+	user *population.User,
+) []string {
+	if randomizer.Float64() < user.ErrorPropensity {
+		return []string{errormix.DrawAny(randomizer)}
 	}
 
-	return reqParams
+	if user.ErrorMix != nil {
+		return errormix.Draw(randomizer, user.ErrorMix)
+	}
+	if errorMix := h.Opts.LoadProfile.ErrorMix(); errorMix != nil {
+		return errormix.Draw(randomizer, errorMix)
+	}
+	return errormix.Draw(randomizer, h.Opts.ErrorMix)
 }
 
-// Performs the HTTP call to the HTTP server
+// Returns the faults which the request params cause
+func faultsOf(
+	reqParams map[string]string,
+) []string {
+	faults := make([]string, 0, len(reqParams))
+	for fault := range reqParams {
+		faults = append(faults, fault)
+	}
+	sort.Strings(faults)
+	return faults
+}
+
+// Performs the HTTP call to the HTTP server and returns the response body
 func (h *HttpServerSimulator) performHttpCall(
 	ctx context.Context,
 	httpMethod string,
 	user string,
 	reqParams map[string]string,
-) error {
+) (
+	[]byte,
+	error,
+) {
 
 	logger.Log(logrus.InfoLevel, ctx, user, "Preparing HTTP call...")
 
@@ -178,7 +472,7 @@ func (h *HttpServerSimulator) performHttpCall(
 	)
 	if err != nil {
 		logger.Log(logrus.ErrorLevel, ctx, user, err.Error())
-		return err
+		return nil, err
 	}
 
 	// Add headers
@@ -201,7 +495,7 @@ func (h *HttpServerSimulator) performHttpCall(
 	res, err := h.Client.Do(ctx, req, fmt.Sprintf("HTTP %s", req.Method))
 	if err != nil {
 		logger.Log(logrus.ErrorLevel, ctx, user, err.Error())
-		return err
+		return nil, err
 	}
 	defer res.Body.Close()
 
@@ -209,15 +503,15 @@ func (h *HttpServerSimulator) performHttpCall(
 	resBody, err := io.ReadAll(res.Body)
 	if err != nil {
 		logger.Log(logrus.ErrorLevel, ctx, user, err.Error())
-		return err
+		return nil, err
 	}
 
 	// Check status code
 	if res.StatusCode != http.StatusOK {
 		logger.Log(logrus.ErrorLevel, ctx, user, string(resBody))
-		return errors.New("call to donald returned not ok status")
+		return nil, errors.New("call to donald returned not ok status")
 	}
 
 	logger.Log(logrus.InfoLevel, ctx, user, "HTTP call is performed successfully.")
-	return nil
+	return resBody, nil
 }
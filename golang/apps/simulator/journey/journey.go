@@ -0,0 +1,151 @@
+package journey
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/duration"
+)
+
+const (
+	// Publishes the name of the journey run via Kafka
+	StepPublish = "publish"
+
+	// Performs a single HTTP call for the name of the journey run
+	StepHttp = "http"
+
+	// Performs GET calls until the name of the journey run is visible
+	StepPoll = "poll"
+
+	// Waits before the next step like a real user would
+	StepThink = "think"
+)
+
+type Step struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// HTTP method of the http step
+	Method string `json:"method,omitempty"`
+
+	// Think time of the think step
+	Duration duration.Duration `json:"duration,omitempty"`
+
+	// Interval between the calls & max duration of the poll step
+	Interval duration.Duration `json:"interval,omitempty"`
+	Timeout  duration.Duration `json:"timeout,omitempty"`
+}
+
+type Journey struct {
+	Name string `json:"name"`
+
+	// Journeys per second unless the load profile defines it
+	Rate float64 `json:"rate"`
+
+	Steps []*Step `json:"steps"`
+}
+
+type Journeys struct {
+	Journeys []*Journey `json:"journeys"`
+}
+
+// Loads the journeys from the given JSON file
+func Load(
+	path string,
+) (
+	*Journeys,
+	error,
+) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(content)
+}
+
+// Parses the journeys out of the given JSON content
+func Parse(
+	content []byte,
+) (
+	*Journeys,
+	error,
+) {
+	j := &Journeys{}
+	if err := json.Unmarshal(content, j); err != nil {
+		return nil, err
+	}
+
+	if err := j.validate(); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Returns the rates of the journeys per name
+func (j *Journeys) Rates() map[string]float64 {
+	rates := make(map[string]float64, len(j.Journeys))
+	for _, journey := range j.Journeys {
+		rates[journey.Name] = journey.Rate
+	}
+	return rates
+}
+
+// Checks the steps and fills up the default values
+func (j *Journeys) validate() error {
+	if len(j.Journeys) == 0 {
+		return errors.New("no journeys are defined")
+	}
+
+	names := map[string]bool{}
+	for i, journey := range j.Journeys {
+		if journey.Name == "" {
+			return fmt.Errorf("journey %d has no name", i)
+		}
+		if names[journey.Name] {
+			return fmt.Errorf("journey %q is defined twice", journey.Name)
+		}
+		names[journey.Name] = true
+
+		if len(journey.Steps) == 0 {
+			return fmt.Errorf("journey %q has no steps", journey.Name)
+		}
+
+		for k, step := range journey.Steps {
+			switch step.Type {
+			case StepPublish:
+			case StepHttp:
+				if step.Method != http.MethodGet && step.Method != http.MethodDelete {
+					return fmt.Errorf("step %d of journey %q has unsupported method %q", k, journey.Name, step.Method)
+				}
+			case StepPoll:
+				if step.Interval <= 0 {
+					step.Interval = duration.Duration(500 * time.Millisecond)
+				}
+				if step.Timeout <= 0 {
+					step.Timeout = duration.Duration(10 * time.Second)
+				}
+			case StepThink:
+				if step.Duration <= 0 {
+					return fmt.Errorf("think step %d of journey %q has no duration", k, journey.Name)
+				}
+			default:
+				return fmt.Errorf("step %d of journey %q has unknown type %q", k, journey.Name, step.Type)
+			}
+
+			if step.Name == "" {
+				step.Name = step.Type
+				if step.Method != "" {
+					step.Name += " " + step.Method
+				}
+			}
+		}
+	}
+
+	return nil
+}
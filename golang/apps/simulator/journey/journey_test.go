@@ -0,0 +1,221 @@
+package journey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/population"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Stores the published names & returns or deletes the one of the name
+// param where GET returns the published ones only after the configured
+// number of calls & the existing ones right away
+type fakeServices struct {
+	mu           sync.Mutex
+	names        []string
+	existing     []string
+	visibleAfter int
+	gets         int
+}
+
+func (f *fakeServices) Publish(
+	_ context.Context,
+	_ *population.User,
+	payload string,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.names = append(f.names, payload)
+	return nil
+}
+
+func (f *fakeServices) Call(
+	_ context.Context,
+	httpMethod string,
+	_ *population.User,
+	reqParams map[string]string,
+) (
+	[]byte,
+	error,
+) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch httpMethod {
+	case http.MethodGet:
+		f.gets++
+		visible := f.existing
+		if f.gets >= f.visibleAfter {
+			visible = append(visible, f.names...)
+		}
+		names := []string{}
+		for _, name := range visible {
+			if name == reqParams["name"] {
+				names = append(names, name)
+			}
+		}
+		return json.Marshal(names)
+	case http.MethodDelete:
+		f.names = remove(f.names, reqParams["name"])
+		f.existing = remove(f.existing, reqParams["name"])
+		return nil, nil
+	}
+	return nil, errors.New("method not allowed")
+}
+
+// Returns the names without the given one
+func remove(
+	names []string,
+	name string,
+) []string {
+	kept := []string{}
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
+
+const publishPollDelete = `{
+	"journeys": [{
+		"name": "publish-poll-delete",
+		"rate": 0.5,
+		"steps": [
+			{"type": "publish"},
+			{"type": "think", "duration": "10ms"},
+			{"type": "poll", "interval": "10ms", "timeout": "200ms"},
+			{"type": "http", "method": "DELETE"}
+		]
+	}]
+}`
+
+func Test_JourneysParsed(t *testing.T) {
+	journeys, err := Parse([]byte(publishPollDelete))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := journeys.Journeys[0].Steps
+	if steps[2].Name != "poll" || steps[3].Name != "http DELETE" {
+		t.Errorf("Step names are not defaulted: %q, %q", steps[2].Name, steps[3].Name)
+	}
+	if journeys.Rates()["publish-poll-delete"] != 0.5 {
+		t.Error("Journey rate is not returned.")
+	}
+
+	_, err = Parse([]byte(`{"journeys": [{"name": "x", "steps": [{"type": "http", "method": "POST"}]}]}`))
+	if err == nil {
+		t.Error("Unsupported method should be rejected.")
+	}
+}
+
+func Test_JourneyTracedUnderSingleRoot(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+
+	journeys, err := Parse([]byte(publishPollDelete))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := &fakeServices{visibleAfter: 3}
+	r := New(services, services)
+	user := &population.User{Id: "elon", Tier: population.TierFree}
+
+	if err := r.Run(context.Background(), journeys.Journeys[0], user, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if services.gets != 3 || len(services.names) != 0 {
+		t.Errorf("Expected 3 polls & a deletion, got %d polls & %v.", services.gets, services.names)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 5 {
+		t.Fatalf("Expected 4 step spans & a root span, got %d.", len(spans))
+	}
+	root := spans[len(spans)-1]
+	if root.Name != "journey publish-poll-delete" || root.Parent.IsValid() {
+		t.Errorf("Last span should be the root span: %s", root.Name)
+	}
+	for _, span := range spans[:4] {
+		if span.SpanContext.TraceID() != root.SpanContext.TraceID() {
+			t.Errorf("Step %s is not in the journey trace.", span.Name)
+		}
+	}
+}
+
+func Test_JourneyPollsOnlyItsOwnName(t *testing.T) {
+	journeys, err := Parse([]byte(publishPollDelete))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Regular traffic has already published the name of the user
+	services := &fakeServices{existing: []string{"elon"}, visibleAfter: 3}
+	r := New(services, services)
+	user := &population.User{Id: "elon", Tier: population.TierFree}
+
+	if err := r.Run(context.Background(), journeys.Journeys[0], user, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if services.gets != 3 {
+		t.Errorf("Poll should wait for the name of the run, got %d polls.", services.gets)
+	}
+	if len(services.names) != 0 || len(services.existing) != 1 {
+		t.Errorf("Only the name of the run should be deleted, got %v.", services.existing)
+	}
+}
+
+func Test_JourneyFailedWhenNotVisible(t *testing.T) {
+	journeys, err := Parse([]byte(publishPollDelete))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := &fakeServices{visibleAfter: 1000}
+	r := New(services, services)
+	user := &population.User{Id: "elon", Tier: population.TierFree}
+
+	startedAt := time.Now()
+	if err := r.Run(context.Background(), journeys.Journeys[0], user, "1"); err == nil {
+		t.Fatal("Journey should fail if the name never becomes visible.")
+	}
+	if time.Since(startedAt) > time.Second {
+		t.Error("Poll should give up after its timeout.")
+	}
+	if len(services.names) != 1 {
+		t.Error("Steps after the failing one should not run.")
+	}
+}
+
+func Test_JourneyStoppedWhenContextCancelled(t *testing.T) {
+	journeys, err := Parse([]byte(`{"journeys": [{"name": "idle", "steps": [{"type": "think", "duration": "1h"}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := &fakeServices{}
+	r := New(services, services)
+	user := &population.User{Id: "elon", Tier: population.TierFree}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	startedAt := time.Now()
+	if err := r.Run(ctx, journeys.Journeys[0], user, "1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the journey to be cancelled, got %v.", err)
+	}
+	if time.Since(startedAt) > time.Second {
+		t.Error("Think step should stop once the context is cancelled.")
+	}
+}
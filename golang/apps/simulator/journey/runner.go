@@ -0,0 +1,345 @@
+package journey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/loadprofile"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/logger"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/population"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/scheduler"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/seed"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/stats"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RunnerName = "simulator_journey_runner"
+
+	JourneyDurationName     = "simulator.journey.duration"
+	JourneyStepDurationName = "simulator.journey.step.duration"
+
+	SimulatorJourneyName             = "simulator.journey.name"
+	SimulatorJourney                 = attribute.Key(SimulatorJourneyName)
+	SimulatorJourneyStepName         = "simulator.journey.step"
+	SimulatorJourneyStep             = attribute.Key(SimulatorJourneyStepName)
+	SimulatorJourneyPollAttemptsName = "simulator.journey.poll.attempts"
+	SimulatorJourneyPollAttempts     = attribute.Key(SimulatorJourneyPollAttemptsName)
+)
+
+// Publishes messages via Kafka
+type Publisher interface {
+	Publish(ctx context.Context, user *population.User, payload string) error
+}
+
+// Performs HTTP calls with the given request params & returns the
+// response body
+type Caller interface {
+	Call(ctx context.Context, httpMethod string, user *population.User, reqParams map[string]string) ([]byte, error)
+}
+
+type Opts struct {
+	LoadProfile     loadprofile.Shape
+	MaxVirtualUsers int64
+	Stats           *stats.Recorder
+	Seed            int64
+}
+
+type OptFunc func(*Opts)
+
+func defaultOpts() *Opts {
+	return &Opts{
+		MaxVirtualUsers: 50,
+		Seed:            time.Now().UnixNano(),
+	}
+}
+
+// Runs the journeys where each of them is traced under a single root span
+type Runner struct {
+	Opts *Opts
+
+	publisher Publisher
+	caller    Caller
+
+	tracer       trace.Tracer
+	duration     metric.Float64Histogram
+	stepDuration metric.Float64Histogram
+}
+
+// Create a journey runner instance
+func New(
+	publisher Publisher,
+	caller Caller,
+	optFuncs ...OptFunc,
+) *Runner {
+
+	// Instantiate options with default values
+	opts := defaultOpts()
+
+	// Apply external options
+	for _, f := range optFuncs {
+		f(opts)
+	}
+
+	// Instantiate trace & meter provider
+	tracer := otel.GetTracerProvider().Tracer(RunnerName)
+	meter := otel.GetMeterProvider().Meter(RunnerName)
+
+	// Create journey duration histogram
+	duration, err := meter.Float64Histogram(
+		JourneyDurationName,
+		metric.WithUnit("ms"),
+		metric.WithDescription("Measures the end-to-end duration of journeys"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	// Create journey step duration histogram
+	stepDuration, err := meter.Float64Histogram(
+		JourneyStepDurationName,
+		metric.WithUnit("ms"),
+		metric.WithDescription("Measures the duration of the individual journey steps"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Runner{
+		Opts: opts,
+
+		publisher: publisher,
+		caller:    caller,
+
+		tracer:       tracer,
+		duration:     duration,
+		stepDuration: stepDuration,
+	}
+}
+
+// Configure load profile which determines the rates of the journeys
+func WithLoadProfile(shape loadprofile.Shape) OptFunc {
+	return func(opts *Opts) {
+		opts.LoadProfile = shape
+	}
+}
+
+// Configure max number of concurrently running journeys per journey
+func WithMaxVirtualUsers(maxVirtualUsers int64) OptFunc {
+	return func(opts *Opts) {
+		opts.MaxVirtualUsers = maxVirtualUsers
+	}
+}
+
+// Configure recorder which aggregates the outcome of the journeys
+func WithStatsRecorder(recorder *stats.Recorder) OptFunc {
+	return func(opts *Opts) {
+		opts.Stats = recorder
+	}
+}
+
+// Configure seed of the user selection
+func WithSeed(seed int64) OptFunc {
+	return func(opts *Opts) {
+		opts.Seed = seed
+	}
+}
+
+// Starts running every journey with the rate of the current load profile phase
+func (r *Runner) Simulate(
+	journeys *Journeys,
+	users *population.Population,
+) {
+	for _, journey := range journeys.Journeys {
+		go r.simulate(journey, users)
+	}
+}
+
+func (r *Runner) simulate(
+	journey *Journey,
+	users *population.Population,
+) {
+	// Each journey draws its own reproducible sequence
+	randomizer := seed.NewRandomizer(r.Opts.Seed, loadprofile.TransportJourney+" "+journey.Name)
+
+	s := scheduler.New(
+		func() float64 {
+			return r.Opts.LoadProfile.Rate(loadprofile.TransportJourney, journey.Name)
+		},
+		func() scheduler.IterationFunc {
+			user := users.Pick(randomizer)
+			runId := strconv.FormatInt(randomizer.Int63(), 36)
+			return func(ctx context.Context) error {
+				return r.Run(ctx, journey, user, runId)
+			}
+		},
+		scheduler.WithOperation(loadprofile.TransportJourney+" "+journey.Name),
+		scheduler.WithMaxVirtualUsers(int(r.Opts.MaxVirtualUsers)),
+	)
+
+	s.Run(context.Background())
+}
+
+// Runs the steps of the journey one after another on behalf of the user
+// under a single root span and stops at the first failing step. The run
+// works only on its own name which is made unique by the run ID so that
+// it is not mixed up with the names of the other runs & regular traffic.
+func (r *Runner) Run(
+	ctx context.Context,
+	journey *Journey,
+	user *population.User,
+	runId string,
+) error {
+	name := user.Id + "-" + runId
+	ctx = population.ContextWithUser(ctx, user)
+
+	ctx, span := r.tracer.Start(ctx, "journey "+journey.Name,
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(SimulatorJourney.String(journey.Name)),
+	)
+	defer span.End()
+
+	logger.Log(logrus.InfoLevel, ctx, user.Id, "Starting journey "+journey.Name+"...")
+
+	journeyStartTime := time.Now()
+	var err error
+	for _, step := range journey.Steps {
+		if err = r.runStep(ctx, journey, step, user, name); err != nil {
+			break
+		}
+	}
+	elapsedTime := time.Since(journeyStartTime)
+
+	r.duration.Record(ctx, float64(elapsedTime)/float64(time.Millisecond),
+		metric.WithAttributes(
+			SimulatorJourney.String(journey.Name),
+			scheduler.Success.Bool(err == nil),
+		))
+	r.Opts.Stats.Record(loadprofile.TransportJourney, journey.Name, elapsedTime, err)
+
+	if err != nil {
+		logger.Log(logrus.ErrorLevel, ctx, user.Id, "Journey "+journey.Name+" is failed: "+err.Error())
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	logger.Log(logrus.InfoLevel, ctx, user.Id, "Journey "+journey.Name+" is completed.")
+	return nil
+}
+
+// Runs a single step within its own span
+func (r *Runner) runStep(
+	ctx context.Context,
+	journey *Journey,
+	step *Step,
+	user *population.User,
+	name string,
+) error {
+	attrs := []attribute.KeyValue{
+		SimulatorJourney.String(journey.Name),
+		SimulatorJourneyStep.String(step.Name),
+	}
+
+	ctx, span := r.tracer.Start(ctx, step.Name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+
+	stepStartTime := time.Now()
+	var err error
+	switch step.Type {
+	case StepPublish:
+		err = r.publisher.Publish(ctx, user, name)
+	case StepHttp:
+		_, err = r.caller.Call(ctx, step.Method, user, map[string]string{"name": name})
+	case StepPoll:
+		err = r.poll(ctx, step, user, name)
+	case StepThink:
+		err = sleep(ctx, time.Duration(step.Duration))
+	}
+
+	elapsedTime := float64(time.Since(stepStartTime)) / float64(time.Millisecond)
+	r.stepDuration.Record(ctx, elapsedTime,
+		metric.WithAttributes(append(attrs, scheduler.Success.Bool(err == nil))...))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Keeps looking up the name of the run with GET calls until it is
+// returned or the timeout is reached
+func (r *Runner) poll(
+	ctx context.Context,
+	step *Step,
+	user *population.User,
+	name string,
+) error {
+	span := trace.SpanFromContext(ctx)
+	deadline := time.Now().Add(time.Duration(step.Timeout))
+
+	attempts := 0
+	for {
+		attempts++
+		span.SetAttributes(SimulatorJourneyPollAttempts.Int(attempts))
+
+		resBody, err := r.caller.Call(ctx, http.MethodGet, user, map[string]string{"name": name})
+		if err == nil && containsName(resBody, name) {
+			return nil
+		}
+
+		if time.Now().Add(time.Duration(step.Interval)).After(deadline) {
+			return fmt.Errorf("%s is not visible after %s", name, time.Duration(step.Timeout))
+		}
+		if err := sleep(ctx, time.Duration(step.Interval)); err != nil {
+			return err
+		}
+	}
+}
+
+// Sleeps for the given duration unless the context is cancelled
+func sleep(
+	ctx context.Context,
+	d time.Duration,
+) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Checks whether the JSON list of names contains the given name
+func containsName(
+	body []byte,
+	name string,
+) bool {
+	names := []string{}
+	if err := json.Unmarshal(body, &names); err != nil {
+		return false
+	}
+
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+// Kafka client settings which the simulator & the kafkaconsumer share. The
+// package is copied into both modules & the copies must be changed together.
+package kafkaconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	SaslMechanismNone        = ""
+	SaslMechanismPlain       = sarama.SASLTypePlaintext
+	SaslMechanismScramSha256 = sarama.SASLTypeSCRAMSHA256
+	SaslMechanismScramSha512 = sarama.SASLTypeSCRAMSHA512
+)
+
+type Opts struct {
+	ClientId string
+
+	TlsEnabled            bool
+	TlsCaPath             string
+	TlsCertPath           string
+	TlsKeyPath            string
+	TlsInsecureSkipVerify bool
+
+	SaslMechanism string
+	SaslUsername  string
+	SaslPassword  string
+}
+
+type OptFunc func(*Opts)
+
+func defaultOpts() *Opts {
+	return &Opts{
+		SaslMechanism: SaslMechanismNone,
+	}
+}
+
+// Connection settings which every Kafka client (admin, producer &
+// consumer) shares
+type ClientConfig struct {
+	Opts *Opts
+}
+
+// Create a client config instance
+func New(
+	optFuncs ...OptFunc,
+) *ClientConfig {
+
+	// Instantiate options with default values
+	opts := defaultOpts()
+
+	// Apply external options
+	for _, f := range optFuncs {
+		f(opts)
+	}
+
+	return &ClientConfig{
+		Opts: opts,
+	}
+}
+
+// Configure client id which the brokers see in their logs & quotas
+func WithClientId(clientId string) OptFunc {
+	if clientId == "" {
+		return func(opts *Opts) {}
+	}
+	return func(opts *Opts) {
+		opts.ClientId = clientId
+	}
+}
+
+// Configure whether the connections to the brokers are encrypted
+func WithTlsEnabled(enabled string) OptFunc {
+	return withOptionalBool(enabled, func(opts *Opts, value bool) {
+		opts.TlsEnabled = value
+	})
+}
+
+// Configure CA certificate file which the broker certificates are
+// verified with
+func WithTlsCaPath(path string) OptFunc {
+	return func(opts *Opts) {
+		opts.TlsCaPath = path
+	}
+}
+
+// Configure client certificate file for mutual TLS
+func WithTlsCertPath(path string) OptFunc {
+	return func(opts *Opts) {
+		opts.TlsCertPath = path
+	}
+}
+
+// Configure client key file for mutual TLS
+func WithTlsKeyPath(path string) OptFunc {
+	return func(opts *Opts) {
+		opts.TlsKeyPath = path
+	}
+}
+
+// Configure whether the broker certificates are not verified
+func WithTlsInsecureSkipVerify(skip string) OptFunc {
+	return withOptionalBool(skip, func(opts *Opts, value bool) {
+		opts.TlsInsecureSkipVerify = value
+	})
+}
+
+// Configure SASL mechanism (PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512)
+func WithSaslMechanism(mechanism string) OptFunc {
+	return func(opts *Opts) {
+		opts.SaslMechanism = mechanism
+	}
+}
+
+// Configure SASL username
+func WithSaslUsername(username string) OptFunc {
+	return func(opts *Opts) {
+		opts.SaslUsername = username
+	}
+}
+
+// Configure SASL password
+func WithSaslPassword(password string) OptFunc {
+	return func(opts *Opts) {
+		opts.SaslPassword = password
+	}
+}
+
+func withOptionalBool(
+	value string,
+	apply func(*Opts, bool),
+) OptFunc {
+	if value == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		panic(err.Error())
+	}
+	return func(opts *Opts) {
+		apply(opts, parsed)
+	}
+}
+
+// Creates a new sarama config with the shared connection settings. The
+// clients add their own settings on top of it.
+func (c *ClientConfig) NewSaramaConfig() (
+	*sarama.Config,
+	error,
+) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V3_0_0_0
+	if c.Opts.ClientId != "" {
+		config.ClientID = c.Opts.ClientId
+	}
+
+	if c.Opts.TlsEnabled {
+		tlsConfig, err := c.newTlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if err := c.configureSasl(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (c *ClientConfig) newTlsConfig() (
+	*tls.Config,
+	error,
+) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.Opts.TlsInsecureSkipVerify,
+	}
+
+	// Trust the given CA instead of the system ones
+	if c.Opts.TlsCaPath != "" {
+		ca, err := os.ReadFile(c.Opts.TlsCaPath)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", c.Opts.TlsCaPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// Authenticate with the client certificate
+	if c.Opts.TlsCertPath != "" || c.Opts.TlsKeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(c.Opts.TlsCertPath, c.Opts.TlsKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func (c *ClientConfig) configureSasl(
+	config *sarama.Config,
+) error {
+	mechanism := c.Opts.SaslMechanism
+	switch mechanism {
+	case SaslMechanismNone:
+		return nil
+	case SaslMechanismPlain:
+	case SaslMechanismScramSha256:
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return newScramClient(sha256Hash)
+		}
+	case SaslMechanismScramSha512:
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return newScramClient(sha512Hash)
+		}
+	default:
+		return fmt.Errorf("unknown SASL mechanism %q", mechanism)
+	}
+
+	if c.Opts.SaslUsername == "" {
+		return errors.New("SASL requires a username")
+	}
+
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Handshake = true
+	config.Net.SASL.Mechanism = sarama.SASLMechanism(mechanism)
+	config.Net.SASL.User = c.Opts.SaslUsername
+	config.Net.SASL.Password = c.Opts.SaslPassword
+	return nil
+}
@@ -2,38 +2,91 @@ package kafkaproducer
 
 import (
 	"context"
-	"fmt"
 	"math/rand"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/sirupsen/logrus"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/event"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/kafkaconfig"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/loadprofile"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/logger"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/population"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/scheduler"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/seed"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/stats"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/topics"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/traffic"
 
 	otelkafka "github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel/kafka"
 )
 
+const (
+	// Operation under which the batches are recorded in the stats
+	OperationPublishBatch = "publish batch"
+
+	// Operation under which the transactions are recorded in the stats
+	OperationPublishTransaction = "publish transaction"
+)
+
 type Opts struct {
-	ServiceName     string
-	RequestInterval int64
-	BrokerAddress   string
-	BrokerTopic     string
+	ServiceName           string
+	RequestInterval       int64
+	BrokerAddress         string
+	BrokerTopic           string
+	ClientConfig          *kafkaconfig.ClientConfig
+	Topics                []*topics.Spec
+	LoadProfile           loadprofile.Shape
+	MaxVirtualUsers       int64
+	PublishTimeout        int64
+	BatchSize             int64
+	Partitions            int64
+	KeyStrategy           string
+	HotKeyRatio           float64
+	MessageEncoding       string
+	SchemaRegistry        *event.Registry
+	ProducerMode          string
+	TransactionAbortRatio float64
+	Stats                 *stats.Recorder
+	Traffic               *traffic.Recorder
+	Seed                  int64
 }
 
 type OptFunc func(*Opts)
 
 func defaultOpts() *Opts {
 	return &Opts{
-		RequestInterval: 2000,
-		BrokerAddress:   "kafka",
-		BrokerTopic:     "otel",
+		RequestInterval:       2000,
+		BrokerAddress:         "kafka",
+		BrokerTopic:           "otel",
+		MaxVirtualUsers:       50,
+		PublishTimeout:        10000,
+		BatchSize:             1,
+		Partitions:            1,
+		KeyStrategy:           KeyStrategyNone,
+		HotKeyRatio:           0.8,
+		MessageEncoding:       event.EncodingJson,
+		ProducerMode:          ProducerModeDefault,
+		TransactionAbortRatio: 0,
+		Seed:                  time.Now().UnixNano(),
 	}
 }
 
 type KafkaConsumerSimulator struct {
 	Opts       *Opts
 	Randomizer *rand.Rand
+
+	// Draws the keys of the messages which are published outside of the
+	// schedule (e.g. by journeys)
+	keyMu         sync.Mutex
+	keyRandomizer *rand.Rand
+
+	startOnce    sync.Once
+	otelproducer *otelkafka.KafkaProducer
+
+	codec *event.Codec
 }
 
 // Create an kafka consumer simulator instance
@@ -49,11 +102,35 @@ func New(
 		f(opts)
 	}
 
-	randomizer := rand.New(rand.NewSource(time.Now().UnixNano()))
+	// Run the request interval forever if no load profile is given
+	if opts.LoadProfile == nil {
+		profile := loadprofile.NewDefault(opts.RequestInterval, opts.RequestInterval)
+		profile.Start()
+		opts.LoadProfile = profile
+	}
+
+	if err := validateKeyStrategy(opts.KeyStrategy); err != nil {
+		panic(err)
+	}
+	if err := validateProducerMode(opts.ProducerMode); err != nil {
+		panic(err)
+	}
+
+	if opts.SchemaRegistry == nil {
+		opts.SchemaRegistry = event.DefaultRegistry()
+	}
+	if opts.ClientConfig == nil {
+		opts.ClientConfig = kafkaconfig.New()
+	}
+
+	randomizer := seed.NewRandomizer(opts.Seed, loadprofile.TransportKafka+" "+loadprofile.OperationPublish)
+	keyRandomizer := seed.NewRandomizer(opts.Seed, loadprofile.TransportKafka+" key")
 
 	return &KafkaConsumerSimulator{
-		Opts:       opts,
-		Randomizer: randomizer,
+		Opts:          opts,
+		Randomizer:    randomizer,
+		keyRandomizer: keyRandomizer,
+		codec:         event.NewCodec(opts.SchemaRegistry, opts.MessageEncoding),
 	}
 }
 
@@ -89,80 +166,302 @@ func WithBrokerTopic(topic string) OptFunc {
 	}
 }
 
+// Configure connection settings (TLS, SASL & client id) of the Kafka clients
+func WithClientConfig(config *kafkaconfig.ClientConfig) OptFunc {
+	return func(opts *Opts) {
+		opts.ClientConfig = config
+	}
+}
+
+// Configure topics which are reconciled next to the broker topic (e.g.
+// dead-letter or retry topics)
+func WithTopics(specs []*topics.Spec) OptFunc {
+	return func(opts *Opts) {
+		opts.Topics = specs
+	}
+}
+
+// Configure load profile which determines the rate of the published messages
+func WithLoadProfile(shape loadprofile.Shape) OptFunc {
+	return func(opts *Opts) {
+		opts.LoadProfile = shape
+	}
+}
+
+// Configure max number of messages in flight at the same time
+func WithMaxVirtualUsers(maxVirtualUsers string) OptFunc {
+	if maxVirtualUsers == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.ParseInt(maxVirtualUsers, 10, 64)
+	if err != nil {
+		panic(err.Error())
+	}
+	if parsed < 1 {
+		panic("max virtual users must be at least 1")
+	}
+	return func(opts *Opts) {
+		opts.MaxVirtualUsers = parsed
+	}
+}
+
+// Configure max duration in milliseconds to wait for the ack of a message
+func WithPublishTimeout(publishTimeout string) OptFunc {
+	if publishTimeout == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.ParseInt(publishTimeout, 10, 64)
+	if err != nil {
+		panic(err.Error())
+	}
+	if parsed < 1 {
+		panic("publish timeout must be at least 1")
+	}
+	return func(opts *Opts) {
+		opts.PublishTimeout = parsed
+	}
+}
+
+// Configure number of messages which are published together as a
+// single batch (1 disables batching)
+func WithBatchSize(batchSize string) OptFunc {
+	if batchSize == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.ParseInt(batchSize, 10, 64)
+	if err != nil {
+		panic(err.Error())
+	}
+	return func(opts *Opts) {
+		opts.BatchSize = parsed
+	}
+}
+
+// Configure number of partitions of the topic
+func WithPartitions(partitions string) OptFunc {
+	if partitions == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.ParseInt(partitions, 10, 64)
+	if err != nil {
+		panic(err.Error())
+	}
+	return func(opts *Opts) {
+		opts.Partitions = parsed
+	}
+}
+
+// Configure how the message keys are chosen (user, random, round_robin
+// or hot_key)
+func WithKeyStrategy(keyStrategy string) OptFunc {
+	return func(opts *Opts) {
+		opts.KeyStrategy = keyStrategy
+	}
+}
+
+// Configure ratio (0-1) of the messages which have the hot key
+func WithHotKeyRatio(hotKeyRatio string) OptFunc {
+	if hotKeyRatio == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.ParseFloat(hotKeyRatio, 64)
+	if err != nil {
+		panic(err.Error())
+	}
+	return func(opts *Opts) {
+		opts.HotKeyRatio = parsed
+	}
+}
+
+// Configure encoding of the messages (json or protobuf)
+func WithMessageEncoding(encoding string) OptFunc {
+	if encoding == "" {
+		return func(opts *Opts) {}
+	}
+	return func(opts *Opts) {
+		opts.MessageEncoding = encoding
+	}
+}
+
+// Configure registry which the messages are validated against
+func WithSchemaRegistry(registry *event.Registry) OptFunc {
+	return func(opts *Opts) {
+		opts.SchemaRegistry = registry
+	}
+}
+
+// Configure delivery guarantees of the producer (default, idempotent or
+// transactional)
+func WithProducerMode(mode string) OptFunc {
+	if mode == "" {
+		return func(opts *Opts) {}
+	}
+	return func(opts *Opts) {
+		opts.ProducerMode = mode
+	}
+}
+
+// Configure ratio (0-1) of the transactions which are aborted instead of
+// committed in transactional mode
+func WithTransactionAbortRatio(abortRatio string) OptFunc {
+	if abortRatio == "" {
+		return func(opts *Opts) {}
+	}
+	parsed, err := strconv.ParseFloat(abortRatio, 64)
+	if err != nil {
+		panic(err.Error())
+	}
+	return func(opts *Opts) {
+		opts.TransactionAbortRatio = parsed
+	}
+}
+
+// Configure seed of the user selection
+func WithSeed(seed int64) OptFunc {
+	return func(opts *Opts) {
+		opts.Seed = seed
+	}
+}
+
+// Configure recorder which aggregates the outcome of the published messages
+func WithStatsRecorder(recorder *stats.Recorder) OptFunc {
+	return func(opts *Opts) {
+		opts.Stats = recorder
+	}
+}
+
+// Configure recorder which writes every published message into a file for replay
+func WithTrafficRecorder(recorder *traffic.Recorder) OptFunc {
+	return func(opts *Opts) {
+		opts.Traffic = recorder
+	}
+}
+
 // Starts simulating Kafka consumer
 func (k *KafkaConsumerSimulator) Simulate(
-	users []string,
+	users *population.Population,
 ) {
 
-	// Create Kafka topic
-	k.createKafkaTopic()
-
 	// Create producer
-	producer := k.createKafkaProducer()
-
-	// Wrap OTel around the producer
-	otelproducer := otelkafka.New(producer)
+	otelproducer := k.start()
 
 	// Publish messages
 	go k.publishMessages(otelproducer, users)
 }
 
-// Creates Kafta topic to publish the messages into
-func (k *KafkaConsumerSimulator) createKafkaTopic() {
+// Re-publishes the recorded messages with their original timing
+// relative to the origin at the given speed
+func (k *KafkaConsumerSimulator) Replay(
+	entries []*traffic.Entry,
+	origin time.Time,
+	speed float64,
+) {
 
-	// Set up configuration
-	config := sarama.NewConfig()
-	config.Version = sarama.V3_0_0_0
-	config.Producer.Return.Successes = true
+	// Create producer
+	otelproducer := k.start()
 
-	// Create client
-	client, err := sarama.NewClient(
-		[]string{k.Opts.BrokerAddress},
-		config,
-	)
+	// Replay messages
+	traffic.Replay(entries, origin, speed, func(entry *traffic.Entry) {
+		user := &population.User{
+			Id:   entry.User,
+			Tier: entry.Tier,
+		}
+		var key sarama.Encoder
+		if entry.Key != "" {
+			key = sarama.StringEncoder(entry.Key)
+		}
+		k.publish(context.Background(), otelproducer, user, key, entry.Payload)
+	})
+}
+
+// Publishes the given payload on behalf of the user within the given
+// context
+func (k *KafkaConsumerSimulator) Publish(
+	ctx context.Context,
+	user *population.User,
+	payload string,
+) error {
+	k.keyMu.Lock()
+	key := k.keyOf(k.keyRandomizer, user)
+	k.keyMu.Unlock()
+
+	return k.publish(ctx, k.start(), user, key, payload)
+}
+
+// Creates the Kafka topic & the instrumented producer once and returns it
+func (k *KafkaConsumerSimulator) start() *otelkafka.KafkaProducer {
+	k.startOnce.Do(func() {
+
+		// Create or update Kafka topics
+		k.reconcileTopics()
+
+		// Create producer
+		transactionalId := k.transactionalId()
+		producer := k.createKafkaProducer(transactionalId)
+
+		// Wrap OTel around the producer
+		k.otelproducer = otelkafka.New(producer,
+			otelkafka.WithPublishTimeout(time.Duration(k.Opts.PublishTimeout)*time.Millisecond),
+			otelkafka.WithProducerMode(k.Opts.ProducerMode),
+			otelkafka.WithTransactionalId(transactionalId),
+		)
+	})
+	return k.otelproducer
+}
+
+// Reconciles the topic to publish the messages into & the configured
+// topics. Failures are logged since publishing reports them as well.
+func (k *KafkaConsumerSimulator) reconcileTopics() {
+	ctx := context.Background()
+
+	// The configured spec of the topic takes precedence
+	specs := topics.WithDefault(k.Opts.Topics, &topics.Spec{
+		Name:              k.Opts.BrokerTopic,
+		Partitions:        int32(k.Opts.Partitions),
+		ReplicationFactor: 1,
+	})
+
+	// Set up configuration
+	config, err := k.Opts.ClientConfig.NewSaramaConfig()
 	if err != nil {
 		panic(err)
 	}
-	defer client.Close()
 
 	// Create admin
-	admin, err := sarama.NewClusterAdminFromClient(client)
+	admin, err := sarama.NewClusterAdmin(
+		[]string{k.Opts.BrokerAddress},
+		config,
+	)
 	if err != nil {
-		panic(err)
+		logger.Log(logrus.ErrorLevel, ctx, "", "Creating Kafka admin is failed: "+err.Error())
+		return
 	}
 	defer admin.Close()
 
-	// Check if topic exists
-	topics, err := admin.ListTopics()
-	if err != nil {
-		panic(err)
+	drifts, err := topics.Reconcile(ctx, admin, specs)
+	for _, drift := range drifts {
+		logger.Log(logrus.WarnLevel, ctx, "", "Topic drift: "+drift.String())
 	}
-
-	// Create topic if not exists
-	_, topicExists := topics[k.Opts.BrokerTopic]
-	if !topicExists {
-
-		err = admin.CreateTopic(
-			k.Opts.BrokerTopic,
-			&sarama.TopicDetail{
-				NumPartitions:     1,
-				ReplicationFactor: 1,
-			}, false)
-		if err != nil {
-			panic(err)
-		}
-
-		fmt.Println("Topic " + k.Opts.BrokerTopic + " is created")
+	if err != nil {
+		logger.Log(logrus.ErrorLevel, ctx, "", "Reconciling topics is failed: "+err.Error())
+		return
 	}
+	logger.Log(logrus.InfoLevel, ctx, "", "Topics are reconciled.")
 }
 
 // Creates the Kafka producer
-func (k *KafkaConsumerSimulator) createKafkaProducer() sarama.AsyncProducer {
+func (k *KafkaConsumerSimulator) createKafkaProducer(
+	transactionalId string,
+) sarama.AsyncProducer {
 
 	// Create config
-	saramaConfig := sarama.NewConfig()
-	saramaConfig.Version = sarama.V3_0_0_0
+	saramaConfig, err := k.Opts.ClientConfig.NewSaramaConfig()
+	if err != nil {
+		panic(err)
+	}
 	saramaConfig.Producer.Return.Successes = true
+	saramaConfig.Producer.Partitioner = partitionerOf(k.Opts.KeyStrategy)
+	configureProducerMode(saramaConfig, k.Opts.ProducerMode, transactionalId)
 
 	// Create producer
 	producer, err := sarama.NewAsyncProducer(
@@ -176,44 +475,198 @@ func (k *KafkaConsumerSimulator) createKafkaProducer() sarama.AsyncProducer {
 	// Wrap producer
 	// producer = otelsarama.WrapAsyncProducer(saramaConfig, producer)
 
-	// Print errors if message publishing goes wrong
-	go func() {
-		for err := range producer.Errors() {
-			fmt.Println("Failed to write message: " + err.Error())
-		}
-	}()
-
 	return producer
 }
 
-// Publish messages to topic
+// Keeps publishing messages with the rate of the current load profile
+// phase on a fixed schedule
 func (k *KafkaConsumerSimulator) publishMessages(
 	otelproducer *otelkafka.KafkaProducer,
-	users []string,
+	users *population.Population,
 ) {
-
-	// Keep publishing messages
-	for {
-		func() {
-			// Make request after each interval
-			time.Sleep(time.Duration(k.Opts.RequestInterval) * time.Millisecond)
+	s := scheduler.New(
+		func() float64 {
+			return k.Opts.LoadProfile.Rate(loadprofile.TransportKafka, loadprofile.OperationPublish)
+		},
+		func() scheduler.IterationFunc {
+			// Publish a batch of messages of random users. In transactional
+			// mode every batch is a transaction.
+			if k.Opts.BatchSize > 1 || k.Opts.ProducerMode == ProducerModeTransactional {
+				batchUsers := make([]*population.User, 0, k.Opts.BatchSize)
+				batchKeys := make([]sarama.Encoder, 0, k.Opts.BatchSize)
+				for i := int64(0); i < k.Opts.BatchSize; i++ {
+					user := users.Pick(k.Randomizer)
+					batchUsers = append(batchUsers, user)
+					batchKeys = append(batchKeys, k.keyOf(k.Randomizer, user))
+				}
+				commit := true
+				if k.Opts.TransactionAbortRatio > 0 {
+					commit = k.Randomizer.Float64() >= k.Opts.TransactionAbortRatio
+				}
+				return func(ctx context.Context) error {
+					return k.publishBatch(ctx, otelproducer, batchUsers, batchKeys, commit)
+				}
+			}
 
 			// Get a random user
-			user := users[k.Randomizer.Intn(len(users))]
-
-			// Create message
-			msg := sarama.ProducerMessage{
-				Topic: k.Opts.BrokerTopic,
-				Value: sarama.ByteEncoder([]byte(user)),
+			user := users.Pick(k.Randomizer)
+			key := k.keyOf(k.Randomizer, user)
+			return func(ctx context.Context) error {
+				return k.publish(ctx, otelproducer, user, key, user.Id)
 			}
+		},
+		scheduler.WithOperation(loadprofile.TransportKafka+" "+loadprofile.OperationPublish),
+		scheduler.WithMaxVirtualUsers(int(k.Opts.MaxVirtualUsers)),
+	)
+
+	s.Run(context.Background())
+}
+
+// Publishes the given payload on behalf of the user and records it
+func (k *KafkaConsumerSimulator) publish(
+	ctx context.Context,
+	otelproducer *otelkafka.KafkaProducer,
+	user *population.User,
+	key sarama.Encoder,
+	payload string,
+) error {
+	// Inject tracing info into message
+	ctx = population.ContextWithUser(ctx, user)
+
+	// Publish message
+	logger.Log(logrus.InfoLevel, ctx, user.Id, "Publishing message...")
+	publishStartTime := time.Now()
+	msg, err := k.createMessage(ctx, user, key, payload)
+	if err == nil {
+		// Transactional producers cannot publish outside of transactions
+		if k.Opts.ProducerMode == ProducerModeTransactional {
+			err = otelproducer.PublishTransaction(ctx, []*sarama.ProducerMessage{msg}, true)
+		} else {
+			err = otelproducer.Publish(ctx, msg)
+		}
+	}
+	elapsedTime := time.Since(publishStartTime)
+
+	k.Opts.Stats.Record(loadprofile.TransportKafka, loadprofile.OperationPublish, elapsedTime, err)
+	k.Opts.Traffic.Record(&traffic.Entry{
+		Timestamp: publishStartTime,
+		Transport: loadprofile.TransportKafka,
+		Operation: loadprofile.OperationPublish,
+		User:      user.Id,
+		Tier:      user.Tier,
+		Key:       keyString(key),
+		Payload:   payload,
+		Duration:  float64(elapsedTime) / float64(time.Millisecond),
+	}, err)
+
+	if err != nil {
+		logger.Log(logrus.ErrorLevel, ctx, user.Id, "Publishing message is failed: "+err.Error())
+		return err
+	}
+	logger.Log(logrus.InfoLevel, ctx, user.Id, "Message published successfully.")
+	return nil
+}
+
+// Publishes the names of the users as a single batch and records each
+// of the messages. In transactional mode the batch is published as a
+// transaction which is committed or aborted as given.
+func (k *KafkaConsumerSimulator) publishBatch(
+	ctx context.Context,
+	otelproducer *otelkafka.KafkaProducer,
+	users []*population.User,
+	keys []sarama.Encoder,
+	commit bool,
+) error {
+	// Publish messages
+	batchSize := strconv.Itoa(len(users))
+	logger.Log(logrus.InfoLevel, ctx, "", "Publishing batch of "+batchSize+" messages...")
+	publishStartTime := time.Now()
+
+	// Create messages
+	var err error
+	msgs := make([]*sarama.ProducerMessage, 0, len(users))
+	for i, user := range users {
+		msg, msgErr := k.createMessage(ctx, user, keys[i], user.Id)
+		if msgErr != nil {
+			err = msgErr
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+
+	operation := OperationPublishBatch
+	if k.Opts.ProducerMode == ProducerModeTransactional {
+		operation = OperationPublishTransaction
+		if err == nil {
+			err = otelproducer.PublishTransaction(ctx, msgs, commit)
+		}
+	} else if err == nil {
+		err = otelproducer.PublishBatch(ctx, msgs)
+	}
+	elapsedTime := time.Since(publishStartTime)
+
+	k.Opts.Stats.Record(loadprofile.TransportKafka, operation, elapsedTime, err)
+	for i, user := range users {
+		k.Opts.Traffic.Record(&traffic.Entry{
+			Timestamp: publishStartTime,
+			Transport: loadprofile.TransportKafka,
+			Operation: loadprofile.OperationPublish,
+			User:      user.Id,
+			Tier:      user.Tier,
+			Key:       keyString(keys[i]),
+			Payload:   user.Id,
+			Duration:  float64(elapsedTime) / float64(time.Millisecond),
+		}, err)
+	}
+
+	if err != nil {
+		logger.Log(logrus.ErrorLevel, ctx, "", "Publishing batch is failed: "+err.Error())
+		return err
+	}
+	logger.Log(logrus.InfoLevel, ctx, "", "Batch of "+batchSize+" messages published successfully.")
+	return nil
+}
 
-			// Inject tracing info into message
-			ctx := context.Background()
+// Wraps the name into the latest version of the user created event &
+// encodes it into a message. The payload carries only the fields which
+// that version defines.
+func (k *KafkaConsumerSimulator) createMessage(
+	ctx context.Context,
+	user *population.User,
+	key sarama.Encoder,
+	name string,
+) (
+	*sarama.ProducerMessage,
+	error,
+) {
+	values := map[string]string{
+		"name": name,
+		"tier": user.Tier,
+	}
 
-			// Publish message
-			logger.Log(logrus.InfoLevel, ctx, user, "Publishing message...")
-			otelproducer.Publish(ctx, &msg)
-			logger.Log(logrus.InfoLevel, ctx, user, "Message published successfully.")
-		}()
+	// Unknown types are left at version 0 & rejected by the validation
+	version := 0
+	payload := map[string]string{}
+	if schema, err := k.Opts.SchemaRegistry.Latest(event.TypeUserCreated); err == nil {
+		version = schema.Version
+		for _, field := range schema.Fields {
+			if value := values[field.Name]; value != "" {
+				payload[field.Name] = value
+			}
+		}
 	}
+
+	value, contentType, err := k.codec.Encode(ctx, event.New(event.TypeUserCreated, version, payload))
+	if err != nil {
+		return nil, err
+	}
+
+	return &sarama.ProducerMessage{
+		Topic: k.Opts.BrokerTopic,
+		Key:   key,
+		Value: sarama.ByteEncoder(value),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(event.ContentTypeHeader), Value: []byte(contentType)},
+		},
+	}, nil
 }
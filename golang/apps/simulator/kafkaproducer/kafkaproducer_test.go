@@ -0,0 +1,47 @@
+package kafkaproducer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/event"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/population"
+)
+
+func Test_MessageCreatedOutOfLatestSchema(t *testing.T) {
+	registry, err := event.NewRegistry([]*event.Schema{
+		{
+			Type:    event.TypeUserCreated,
+			Version: 1,
+			Fields: []event.Field{
+				{Name: "name", Required: true},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := New(WithSchemaRegistry(registry))
+	user := &population.User{Id: "elon", Tier: population.TierPremium}
+
+	msg, err := k.createMessage(context.Background(), user, nil, user.Id)
+	if err != nil {
+		t.Fatalf("Message should match the v1 schema: %v", err)
+	}
+
+	value, err := msg.Value.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := k.codec.Decode(context.Background(), value, string(msg.Headers[0].Value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Version != 1 {
+		t.Errorf("Expected version 1, got %d.", envelope.Version)
+	}
+	if _, ok := envelope.Payload["tier"]; ok || envelope.Payload["name"] != "elon" {
+		t.Errorf("Payload should carry only the v1 fields: %v", envelope.Payload)
+	}
+}
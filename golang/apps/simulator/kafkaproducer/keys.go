@@ -0,0 +1,89 @@
+package kafkaproducer
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	"github.com/IBM/sarama"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/population"
+)
+
+const (
+	// Messages have no key & are spread randomly across the partitions
+	KeyStrategyNone = ""
+
+	// Messages of a user have the user id as key & end up on the same partition
+	KeyStrategyUser = "user"
+
+	// Messages have a random key
+	KeyStrategyRandom = "random"
+
+	// Messages have the user id as key but are spread across the
+	// partitions one after another
+	KeyStrategyRoundRobin = "round_robin"
+
+	// Most of the messages have the same key & end up on the same
+	// partition, the rest has the user id as key
+	KeyStrategyHotKey = "hot_key"
+
+	// Key of the messages which are skewed to the hot partition
+	HotKey = "hot-key"
+)
+
+// Checks whether the key strategy is known
+func validateKeyStrategy(
+	strategy string,
+) error {
+	switch strategy {
+	case KeyStrategyNone, KeyStrategyUser, KeyStrategyRandom, KeyStrategyRoundRobin, KeyStrategyHotKey:
+		return nil
+	default:
+		return fmt.Errorf("unknown key strategy %q", strategy)
+	}
+}
+
+// Returns the partitioner which the key strategy requires
+func partitionerOf(
+	strategy string,
+) sarama.PartitionerConstructor {
+	if strategy == KeyStrategyRoundRobin {
+		return sarama.NewRoundRobinPartitioner
+	}
+	return sarama.NewHashPartitioner
+}
+
+// Creates the key of the next message of the user according to the
+// key strategy
+func (k *KafkaConsumerSimulator) keyOf(
+	randomizer *rand.Rand,
+	user *population.User,
+) sarama.Encoder {
+	switch k.Opts.KeyStrategy {
+	case KeyStrategyUser, KeyStrategyRoundRobin:
+		return sarama.StringEncoder(user.Id)
+	case KeyStrategyRandom:
+		return sarama.StringEncoder(strconv.FormatUint(randomizer.Uint64(), 16))
+	case KeyStrategyHotKey:
+		if randomizer.Float64() < k.Opts.HotKeyRatio {
+			return sarama.StringEncoder(HotKey)
+		}
+		return sarama.StringEncoder(user.Id)
+	default:
+		return nil
+	}
+}
+
+// Returns the key as string for recording
+func keyString(
+	key sarama.Encoder,
+) string {
+	if key == nil {
+		return ""
+	}
+	encoded, err := key.Encode()
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
@@ -0,0 +1,54 @@
+package kafkaproducer
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/population"
+)
+
+func Test_HotKeySkewed(t *testing.T) {
+	k := New(
+		WithKeyStrategy(KeyStrategyHotKey),
+		WithHotKeyRatio("0.8"),
+	)
+	randomizer := rand.New(rand.NewSource(42))
+	user := &population.User{Id: "elon"}
+
+	hot := 0
+	draws := 10000
+	for i := 0; i < draws; i++ {
+		if keyString(k.keyOf(randomizer, user)) == HotKey {
+			hot++
+		}
+	}
+
+	ratio := float64(hot) / float64(draws)
+	if ratio < 0.78 || ratio > 0.82 {
+		t.Errorf("Expected around 80%% hot keys, got %.3f.", ratio)
+	}
+}
+
+func Test_KeysOfStrategies(t *testing.T) {
+	randomizer := rand.New(rand.NewSource(42))
+	user := &population.User{Id: "elon"}
+
+	if key := New().keyOf(randomizer, user); key != nil {
+		t.Error("Messages should have no key by default.")
+	}
+	if key := New(WithKeyStrategy(KeyStrategyUser)).keyOf(randomizer, user); keyString(key) != "elon" {
+		t.Error("User strategy should use the user id as key.")
+	}
+
+	random := New(WithKeyStrategy(KeyStrategyRandom))
+	if keyString(random.keyOf(randomizer, user)) == keyString(random.keyOf(randomizer, user)) {
+		t.Error("Random strategy should create different keys.")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Unknown key strategy should be rejected.")
+		}
+	}()
+	New(WithKeyStrategy("unknown"))
+}
@@ -0,0 +1,61 @@
+package kafkaproducer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	// Messages are published at least once & may be duplicated on retries
+	ProducerModeDefault = "default"
+
+	// Retried messages are deduplicated by the broker
+	ProducerModeIdempotent = "idempotent"
+
+	// Batches of messages are published within transactions which are
+	// either committed or aborted as a whole
+	ProducerModeTransactional = "transactional"
+)
+
+// Checks whether the producer mode is known
+func validateProducerMode(
+	mode string,
+) error {
+	switch mode {
+	case ProducerModeDefault, ProducerModeIdempotent, ProducerModeTransactional:
+		return nil
+	default:
+		return fmt.Errorf("unknown producer mode %q", mode)
+	}
+}
+
+// Configures the delivery guarantees which the producer mode requires
+func configureProducerMode(
+	config *sarama.Config,
+	mode string,
+	transactionalId string,
+) {
+	if mode == ProducerModeDefault {
+		return
+	}
+
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Net.MaxOpenRequests = 1
+
+	if mode == ProducerModeTransactional {
+		config.Producer.Transaction.ID = transactionalId
+	}
+}
+
+// Returns the transactional id which is unique per simulator instance
+// so that the instances do not fence each other
+func (k *KafkaConsumerSimulator) transactionalId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return k.Opts.ServiceName
+	}
+	return k.Opts.ServiceName + "-" + hostname
+}
@@ -0,0 +1,32 @@
+package kafkaproducer
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+func Test_ProducerModesConfigureValidProducers(t *testing.T) {
+	for _, mode := range []string{ProducerModeDefault, ProducerModeIdempotent, ProducerModeTransactional} {
+		config := sarama.NewConfig()
+		config.Version = sarama.V3_0_0_0
+		config.Producer.Return.Successes = true
+		configureProducerMode(config, mode, "simulator")
+
+		if err := config.Validate(); err != nil {
+			t.Errorf("%s: %v", mode, err)
+		}
+		if config.Producer.Idempotent != (mode != ProducerModeDefault) {
+			t.Errorf("%s: unexpected idempotence %t.", mode, config.Producer.Idempotent)
+		}
+		if (config.Producer.Transaction.ID != "") != (mode == ProducerModeTransactional) {
+			t.Errorf("%s: unexpected transactional id %q.", mode, config.Producer.Transaction.ID)
+		}
+	}
+}
+
+func Test_UnknownProducerModeRejected(t *testing.T) {
+	if err := validateProducerMode("exactly_once"); err == nil {
+		t.Error("Unknown producer mode should be rejected.")
+	}
+}
@@ -0,0 +1,321 @@
+package loadprofile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/duration"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/errormix"
+)
+
+const (
+	TransportHttp    = "http"
+	TransportKafka   = "kafka"
+	TransportJourney = "journey"
+
+	OperationPublish = "publish"
+
+	// How often a paused operation checks whether it should resume
+	PauseCheckInterval = time.Second
+)
+
+// Provides the traffic shape to the generators
+type Shape interface {
+	// Current rate in requests per second of the given operation
+	Rate(transport string, operation string) float64
+
+	// Current probability per error to be caused by a request
+	ErrorMix() map[string]float64
+
+	// Profile which is currently executed
+	CurrentProfile() *Profile
+}
+
+type PhaseType string
+
+const (
+	// Rates go linearly from the "from" factor to the "to" factor
+	PhaseRamp PhaseType = "ramp"
+
+	// Rates are kept as they are
+	PhaseSteady PhaseType = "steady"
+
+	// Rates are multiplied by the factor
+	PhaseSpike PhaseType = "spike"
+
+	// Rates oscillate around their values with the given amplitude & period
+	PhaseSine PhaseType = "sine"
+
+	// No traffic at all
+	PhasePause PhaseType = "pause"
+)
+
+type Phase struct {
+	Name     string            `json:"name"`
+	Type     PhaseType         `json:"type"`
+	Duration duration.Duration `json:"duration"`
+
+	// Target rates in requests per second per transport & operation
+	// (e.g. http -> GET). Inherited from the previous phase if not given.
+	Rates map[string]map[string]float64 `json:"rates,omitempty"`
+
+	// Ramp. The "to" factor is 1 if not given.
+	From float64  `json:"from,omitempty"`
+	To   *float64 `json:"to,omitempty"`
+
+	// Spike
+	Factor float64 `json:"factor,omitempty"`
+
+	// Sine
+	Amplitude float64           `json:"amplitude,omitempty"`
+	Period    duration.Duration `json:"period,omitempty"`
+
+	// Probability per error or combination of errors (e.g. "a+b") to be
+	// caused by a request. Inherited from the previous phase if not given.
+	ErrorMix map[string]float64 `json:"errorMix,omitempty"`
+}
+
+type Profile struct {
+	Name   string   `json:"name"`
+	Loop   bool     `json:"loop"`
+	Phases []*Phase `json:"phases"`
+
+	startedAt     time.Time
+	totalDuration time.Duration
+}
+
+// Loads the load profile from the given JSON file
+func Load(
+	path string,
+) (
+	*Profile,
+	error,
+) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(content)
+}
+
+// Parses the load profile out of the given JSON content
+func Parse(
+	content []byte,
+) (
+	*Profile,
+	error,
+) {
+	profile := &Profile{}
+	if err := json.Unmarshal(content, profile); err != nil {
+		return nil, err
+	}
+
+	if err := profile.validate(); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// Creates a profile which runs the given intervals (in milliseconds) forever.
+// DELETE requests are made 4 times less frequent than GET requests.
+func NewDefault(
+	httpInterval int64,
+	kafkaInterval int64,
+) *Profile {
+	httpRate := 1000 / float64(httpInterval)
+	kafkaRate := 1000 / float64(kafkaInterval)
+
+	profile := &Profile{
+		Name: "default",
+		Loop: true,
+		Phases: []*Phase{
+			{
+				Name:     "steady",
+				Type:     PhaseSteady,
+				Duration: duration.Duration(time.Hour),
+				Rates: map[string]map[string]float64{
+					TransportHttp: {
+						"GET":    httpRate,
+						"DELETE": httpRate / 4,
+					},
+					TransportKafka: {
+						OperationPublish: kafkaRate,
+					},
+				},
+			},
+		},
+	}
+
+	if err := profile.validate(); err != nil {
+		panic(err)
+	}
+	return profile
+}
+
+// Checks the phases and fills up the inherited values
+func (p *Profile) validate() error {
+	if len(p.Phases) == 0 {
+		return errors.New("load profile has no phases")
+	}
+
+	p.totalDuration = 0
+	for i, phase := range p.Phases {
+		if phase.Duration <= 0 {
+			return fmt.Errorf("phase %d has no duration", i)
+		}
+
+		switch phase.Type {
+		case PhaseRamp:
+			if phase.To == nil {
+				to := 1.0
+				phase.To = &to
+			}
+		case PhaseSpike:
+			if phase.Factor == 0 {
+				return fmt.Errorf("spike phase %d has no factor", i)
+			}
+		case PhaseSine:
+			if phase.Period <= 0 {
+				return fmt.Errorf("sine phase %d has no period", i)
+			}
+		case PhaseSteady, PhasePause:
+		default:
+			return fmt.Errorf("phase %d has unknown type %q", i, phase.Type)
+		}
+
+		if err := errormix.Validate(phase.ErrorMix); err != nil {
+			return fmt.Errorf("phase %d has invalid error mix: %w", i, err)
+		}
+
+		if i > 0 {
+			if phase.Rates == nil {
+				phase.Rates = p.Phases[i-1].Rates
+			}
+			if phase.ErrorMix == nil {
+				phase.ErrorMix = p.Phases[i-1].ErrorMix
+			}
+		}
+
+		if phase.Name == "" {
+			phase.Name = fmt.Sprintf("%s-%d", phase.Type, i)
+		}
+
+		p.totalDuration += time.Duration(phase.Duration)
+	}
+
+	return nil
+}
+
+// Sets the rates of the given operations in every phase which does not
+// define them itself
+func (p *Profile) SetDefaultRates(
+	transport string,
+	rates map[string]float64,
+) {
+	for _, phase := range p.Phases {
+		if phase.Rates == nil {
+			phase.Rates = map[string]map[string]float64{}
+		}
+		if phase.Rates[transport] == nil {
+			phase.Rates[transport] = map[string]float64{}
+		}
+		for operation, rate := range rates {
+			if _, ok := phase.Rates[transport][operation]; !ok {
+				phase.Rates[transport][operation] = rate
+			}
+		}
+	}
+}
+
+// Starts executing the profile from its first phase
+func (p *Profile) Start() {
+	p.startedAt = time.Now()
+}
+
+// Returns the phase which is active at the given time and how long it
+// has been active. The last phase is kept once a non looping profile is over.
+func (p *Profile) PhaseAt(
+	t time.Time,
+) (
+	*Phase,
+	time.Duration,
+) {
+	elapsed := t.Sub(p.startedAt)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	if elapsed >= p.totalDuration {
+		if !p.Loop {
+			last := p.Phases[len(p.Phases)-1]
+			return last, time.Duration(last.Duration)
+		}
+		elapsed = elapsed % p.totalDuration
+	}
+
+	for _, phase := range p.Phases {
+		if elapsed < time.Duration(phase.Duration) {
+			return phase, elapsed
+		}
+		elapsed -= time.Duration(phase.Duration)
+	}
+
+	last := p.Phases[len(p.Phases)-1]
+	return last, time.Duration(last.Duration)
+}
+
+// Returns the profile itself
+func (p *Profile) CurrentProfile() *Profile {
+	return p
+}
+
+// Returns the current phase
+func (p *Profile) CurrentPhase() *Phase {
+	phase, _ := p.PhaseAt(time.Now())
+	return phase
+}
+
+// Returns the current rate in requests per second of the given operation
+func (p *Profile) Rate(
+	transport string,
+	operation string,
+) float64 {
+	phase, elapsed := p.PhaseAt(time.Now())
+	return phase.rate(transport, operation, elapsed)
+}
+
+// Returns the error mix of the current phase
+func (p *Profile) ErrorMix() map[string]float64 {
+	return p.CurrentPhase().ErrorMix
+}
+
+// Calculates the rate of the operation after the phase has been active
+// for the given time
+func (p *Phase) rate(
+	transport string,
+	operation string,
+	elapsed time.Duration,
+) float64 {
+	base := p.Rates[transport][operation]
+
+	switch p.Type {
+	case PhaseRamp:
+		progress := float64(elapsed) / float64(p.Duration)
+		return base * (p.From + (*p.To-p.From)*progress)
+	case PhaseSpike:
+		return base * p.Factor
+	case PhaseSine:
+		angle := 2 * math.Pi * float64(elapsed) / float64(p.Period)
+		return math.Max(0, base*(1+p.Amplitude*math.Sin(angle)))
+	case PhasePause:
+		return 0
+	default:
+		return base
+	}
+}
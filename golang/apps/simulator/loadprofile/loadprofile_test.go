@@ -0,0 +1,118 @@
+package loadprofile
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ProfileParsedCorrectly(t *testing.T) {
+	content := []byte(`{
+		"name": "test",
+		"loop": true,
+		"phases": [
+			{
+				"name": "warmup",
+				"type": "ramp",
+				"duration": "1m",
+				"rates": {"http": {"GET": 10}},
+				"errorMix": {"databaseConnectionError": 0.1}
+			},
+			{
+				"name": "burst",
+				"type": "spike",
+				"duration": "30s",
+				"factor": 5
+			},
+			{
+				"type": "pause",
+				"duration": "30s"
+			}
+		]
+	}`)
+
+	profile, err := Parse(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rates & error mix are inherited from the previous phase
+	if profile.Phases[1].Rates["http"]["GET"] != 10 {
+		t.Error("Rates are not inherited from the previous phase.")
+	}
+	if profile.Phases[1].ErrorMix["databaseConnectionError"] != 0.1 {
+		t.Error("Error mix is not inherited from the previous phase.")
+	}
+
+	// Phases without name are named after their type
+	if profile.Phases[2].Name != "pause-2" {
+		t.Errorf("Unexpected phase name %s.", profile.Phases[2].Name)
+	}
+}
+
+func Test_RatesCalculatedPerPhase(t *testing.T) {
+	content := []byte(`{
+		"name": "test",
+		"loop": true,
+		"phases": [
+			{"name": "ramp", "type": "ramp", "duration": "1m", "rates": {"http": {"GET": 10}}},
+			{"name": "spike", "type": "spike", "duration": "1m", "factor": 3},
+			{"name": "pause", "type": "pause", "duration": "1m"},
+			{"name": "rampdown", "type": "ramp", "duration": "1m", "from": 1, "to": 0}
+		]
+	}`)
+
+	profile, err := Parse(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile.Start()
+	start := profile.startedAt
+
+	tests := []struct {
+		offset time.Duration
+		phase  string
+		rate   float64
+	}{
+		{30 * time.Second, "ramp", 5},
+		{90 * time.Second, "spike", 30},
+		{150 * time.Second, "pause", 0},
+		{210 * time.Second, "rampdown", 5},
+		{270 * time.Second, "ramp", 5}, // looped
+	}
+
+	for _, test := range tests {
+		phase, elapsed := profile.PhaseAt(start.Add(test.offset))
+		if phase.Name != test.phase {
+			t.Errorf("Expected phase %s at %s, got %s.", test.phase, test.offset, phase.Name)
+		}
+		if rate := phase.rate("http", "GET", elapsed); rate != test.rate {
+			t.Errorf("Expected rate %f at %s, got %f.", test.rate, test.offset, rate)
+		}
+	}
+}
+
+func Test_InvalidProfileRejected(t *testing.T) {
+	_, err := Parse([]byte(`{"phases": [{"type": "spike", "duration": "1m"}]}`))
+	if err == nil {
+		t.Error("Spike phase without factor should be rejected.")
+	}
+
+	_, err = Parse([]byte(`{"phases": []}`))
+	if err == nil {
+		t.Error("Profile without phases should be rejected.")
+	}
+}
+
+func Test_DefaultRatesSet(t *testing.T) {
+	profile := NewDefault(1000, 1000)
+	profile.SetDefaultRates(TransportJourney, map[string]float64{"publish-poll-delete": 0.5})
+	profile.SetDefaultRates(TransportHttp, map[string]float64{"GET": 100})
+	profile.Start()
+
+	if profile.Rate(TransportJourney, "publish-poll-delete") != 0.5 {
+		t.Error("Default journey rate is not set.")
+	}
+	if profile.Rate(TransportHttp, "GET") != 1 {
+		t.Error("Rates of the profile should not be overwritten.")
+	}
+}
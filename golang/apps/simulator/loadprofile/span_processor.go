@@ -0,0 +1,45 @@
+package loadprofile
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	LoadProfileNameName  = "simulator.load_profile.name"
+	LoadProfileName      = attribute.Key(LoadProfileNameName)
+	LoadProfilePhaseName = "simulator.load_profile.phase"
+	LoadProfilePhase     = attribute.Key(LoadProfilePhaseName)
+)
+
+// Adds the active load profile phase to every started span
+type spanProcessor struct {
+	shape Shape
+}
+
+func NewSpanProcessor(
+	shape Shape,
+) sdktrace.SpanProcessor {
+	return &spanProcessor{
+		shape: shape,
+	}
+}
+
+func (p *spanProcessor) OnStart(
+	_ context.Context,
+	span sdktrace.ReadWriteSpan,
+) {
+	profile := p.shape.CurrentProfile()
+	span.SetAttributes(
+		LoadProfileName.String(profile.Name),
+		LoadProfilePhase.String(profile.CurrentPhase().Name),
+	)
+}
+
+func (p *spanProcessor) OnEnd(_ sdktrace.ReadOnlySpan) {}
+
+func (p *spanProcessor) Shutdown(_ context.Context) error { return nil }
+
+func (p *spanProcessor) ForceFlush(_ context.Context) error { return nil }
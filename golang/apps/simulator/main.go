@@ -2,15 +2,31 @@ package main
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/config"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/controlplane"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/errormix"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/event"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/httpclient"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/journey"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/kafkaconfig"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/kafkaproducer"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/loadprofile"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/logger"
 	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/population"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/seed"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/stats"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/topics"
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/traffic"
 	"go.opentelemetry.io/contrib/instrumentation/runtime"
 )
 
@@ -24,8 +40,34 @@ func main() {
 	// Initialize logger
 	logger.NewLogger(cfg)
 
+	// Create seed of the simulation
+	simulationSeed := seed.Parse(cfg.Seed)
+	logger.Log(logrus.InfoLevel, ctx, "", "Simulation seed is "+strconv.FormatInt(simulationSeed, 10)+".")
+	otel.SetResourceAttributes(seed.SimulatorSeed.Int64(simulationSeed))
+
+	// Create load profile
+	profile := createLoadProfile(cfg)
+
+	// Create control plane to retune the traffic at runtime
+	cp := controlplane.New(profile)
+
+	// Create journeys & run them with their own rates unless the
+	// profile defines them, even after the profile is switched
+	journeys := createJourneys(cfg)
+	if journeys != nil {
+		cp.SetDefaultRates(loadprofile.TransportJourney, journeys.Rates())
+	}
+	profile.Start()
+
+	// Create user population
+	users := createPopulation(cfg)
+
 	// Create tracer provider
-	tp := otel.NewTraceProvider(ctx)
+	tp := otel.NewTraceProvider(ctx,
+		loadprofile.NewSpanProcessor(cp),
+		population.NewSpanProcessor(),
+		errormix.NewSpanProcessor(),
+	)
 	defer otel.ShutdownTraceProvider(ctx, tp)
 
 	// Create metric provider
@@ -38,43 +80,310 @@ func main() {
 		panic(err)
 	}
 
-	// Simulate
-	go simulateHttpServer(cfg)
-	go simulateKafkaConsumer(cfg)
+	// Create stats recorder
+	recorder := stats.New()
+
+	// Create traffic recorder if the calls should be recorded for replay
+	trafficRecorder := createTrafficRecorder(cfg)
+	defer trafficRecorder.Close()
+
+	// Serve live statistics & control plane
+	http.Handle("/stats", http.HandlerFunc(recorder.Stats))
+	http.Handle("/control", http.HandlerFunc(cp.Control))
+	http.Handle("/control/pause", http.HandlerFunc(cp.Pause))
+	http.Handle("/control/resume", http.HandlerFunc(cp.Resume))
+	http.Handle("/control/rates", http.HandlerFunc(cp.Rates))
+	http.Handle("/control/errors", http.HandlerFunc(cp.Errors))
+	http.Handle("/control/profile", http.HandlerFunc(cp.Profile))
+	go http.ListenAndServe(":"+servicePort(cfg), nil)
+
+	// Create simulators
+	httpserverSimulator := createHttpServerSimulator(cfg, cp, recorder, trafficRecorder, simulationSeed)
+	kafkaConsumerSimulator := createKafkaConsumerSimulator(cfg, cp, recorder, trafficRecorder, simulationSeed)
+
+	if cfg.TrafficReplayPath != "" {
+		// Replay the recorded traffic
+		go replayTraffic(ctx, cfg, httpserverSimulator, kafkaConsumerSimulator)
+	} else {
+		// Simulate
+		go httpserverSimulator.Simulate(users)
+		go kafkaConsumerSimulator.Simulate(users)
+
+		// Run journeys across both of them
+		if journeys != nil {
+			journeyRunner := journey.New(kafkaConsumerSimulator, httpserverSimulator,
+				journey.WithLoadProfile(cp),
+				journey.WithStatsRecorder(recorder),
+				journey.WithSeed(simulationSeed),
+			)
+			go journeyRunner.Simulate(journeys, users)
+		}
+	}
 
 	// Wait for signal to shutdown the simulator
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	<-ctx.Done()
+
+	// Print what the simulator has done
+	recorder.WriteSummary(os.Stdout)
+}
+
+// Returns the port to serve on
+func servicePort(
+	cfg *config.SimulatorConfig,
+) string {
+	if cfg.ServicePort == "" {
+		return "8080"
+	}
+	return cfg.ServicePort
 }
 
-func simulateHttpServer(
+// Loads the load profile from the given file or creates the default
+// one out of the request intervals
+func createLoadProfile(
 	cfg *config.SimulatorConfig,
+) *loadprofile.Profile {
+	if cfg.LoadProfilePath != "" {
+		profile, err := loadprofile.Load(cfg.LoadProfilePath)
+		if err != nil {
+			panic(err)
+		}
+		return profile
+	}
+
+	httpInterval, err := strconv.ParseInt(cfg.HttpserverRequestInterval, 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	kafkaInterval, err := strconv.ParseInt(cfg.KafkaRequestInterval, 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return loadprofile.NewDefault(httpInterval, kafkaInterval)
+}
+
+// Loads the journeys from the given file if there is any
+func createJourneys(
+	cfg *config.SimulatorConfig,
+) *journey.Journeys {
+	if cfg.JourneysPath == "" {
+		return nil
+	}
+
+	journeys, err := journey.Load(cfg.JourneysPath)
+	if err != nil {
+		panic(err)
+	}
+	return journeys
+}
+
+// Creates the connection settings which every Kafka client shares
+func createKafkaClientConfig(
+	cfg *config.SimulatorConfig,
+) *kafkaconfig.ClientConfig {
+	// The service name is the client id unless another one is given
+	return kafkaconfig.New(
+		kafkaconfig.WithClientId(cfg.ServiceName),
+		kafkaconfig.WithClientId(cfg.KafkaClientId),
+		kafkaconfig.WithTlsEnabled(cfg.KafkaTlsEnabled),
+		kafkaconfig.WithTlsCaPath(cfg.KafkaTlsCaPath),
+		kafkaconfig.WithTlsCertPath(cfg.KafkaTlsCertPath),
+		kafkaconfig.WithTlsKeyPath(cfg.KafkaTlsKeyPath),
+		kafkaconfig.WithTlsInsecureSkipVerify(cfg.KafkaTlsInsecureSkipVerify),
+		kafkaconfig.WithSaslMechanism(cfg.KafkaSaslMechanism),
+		kafkaconfig.WithSaslUsername(cfg.KafkaSaslUsername),
+		kafkaconfig.WithSaslPassword(cfg.KafkaSaslPassword),
+	)
+}
+
+// Loads the specs of the topics to reconcile from the given file if
+// there is any
+func createTopicSpecs(
+	cfg *config.SimulatorConfig,
+) []*topics.Spec {
+	if cfg.KafkaTopicsPath == "" {
+		return nil
+	}
+
+	specs, err := topics.Load(cfg.KafkaTopicsPath)
+	if err != nil {
+		panic(err)
+	}
+	return specs
+}
+
+// Loads the schema registry from the given file or falls back to the
+// built-in schemas
+func createSchemaRegistry(
+	cfg *config.SimulatorConfig,
+) *event.Registry {
+	if cfg.SchemaRegistryPath == "" {
+		return event.DefaultRegistry()
+	}
+
+	registry, err := event.LoadRegistry(cfg.SchemaRegistryPath)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// Loads the users from the given file, generates the given number of
+// synthetic users or falls back to the default users
+func createPopulation(
+	cfg *config.SimulatorConfig,
+) *population.Population {
+	if cfg.UsersPath != "" {
+		users, err := population.Load(cfg.UsersPath)
+		if err != nil {
+			panic(err)
+		}
+		return users
+	}
+
+	if cfg.UsersCount != "" {
+		count, err := strconv.Atoi(cfg.UsersCount)
+		if err != nil {
+			panic(err)
+		}
+
+		exponent := 1.0
+		if cfg.UsersZipfExponent != "" {
+			exponent, err = strconv.ParseFloat(cfg.UsersZipfExponent, 64)
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		users, err := population.Generate(count, cfg.UsersDistribution, exponent)
+		if err != nil {
+			panic(err)
+		}
+		return users
+	}
+
+	return population.FromNames(cfg.Users)
+}
+
+// Creates the traffic recorder if a recording file is given
+func createTrafficRecorder(
+	cfg *config.SimulatorConfig,
+) *traffic.Recorder {
+	if cfg.TrafficRecordPath == "" {
+		return nil
+	}
+
+	trafficRecorder, err := traffic.NewRecorder(cfg.TrafficRecordPath)
+	if err != nil {
+		panic(err)
+	}
+	return trafficRecorder
+}
+
+// Re-issues the recorded HTTP calls & Kafka messages with their
+// original timing at the given speed
+func replayTraffic(
+	ctx context.Context,
+	cfg *config.SimulatorConfig,
+	httpserverSimulator *httpclient.HttpServerSimulator,
+	kafkaConsumerSimulator *kafkaproducer.KafkaConsumerSimulator,
 ) {
+	entries, err := traffic.Load(cfg.TrafficReplayPath)
+	if err != nil {
+		panic(err)
+	}
+	if len(entries) == 0 {
+		logger.Log(logrus.WarnLevel, ctx, "", "Traffic recording "+cfg.TrafficReplayPath+" is empty.")
+		return
+	}
+
+	speed := 1.0
+	if cfg.TrafficReplaySpeed != "" {
+		speed, err = strconv.ParseFloat(cfg.TrafficReplaySpeed, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	logger.Log(logrus.InfoLevel, ctx, "", "Replaying "+strconv.Itoa(len(entries))+" recorded calls at "+strconv.FormatFloat(speed, 'f', -1, 64)+"x speed...")
+
+	// Both transports share the start of the recording to keep their
+	// relative timing
+	origin := entries[0].Timestamp
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		httpserverSimulator.Replay(traffic.Filter(entries, loadprofile.TransportHttp), origin, speed)
+	}()
+	go func() {
+		defer wg.Done()
+		kafkaConsumerSimulator.Replay(traffic.Filter(entries, loadprofile.TransportKafka), origin, speed)
+	}()
+	wg.Wait()
+
+	logger.Log(logrus.InfoLevel, ctx, "", "Traffic replay is completed.")
+}
+
+func createHttpServerSimulator(
+	cfg *config.SimulatorConfig,
+	shape loadprofile.Shape,
+	recorder *stats.Recorder,
+	trafficRecorder *traffic.Recorder,
+	simulationSeed int64,
+) *httpclient.HttpServerSimulator {
 	// Instantiate HTTP server simulator
-	httpserverSimulator := httpclient.New(
+	return httpclient.New(
 		httpclient.WithServiceName(cfg.ServiceName),
 		httpclient.WithRequestInterval(cfg.HttpserverRequestInterval),
 		httpclient.WithServerEndpoint(cfg.HttpserverEndpoint),
 		httpclient.WithServerPort(cfg.HttpserverPort),
+		httpclient.WithMaxVirtualUsers(cfg.HttpserverMaxVirtualUsers),
+		httpclient.WithRetryAttempts(cfg.HttpserverRetryAttempts),
+		httpclient.WithRetryBackoff(cfg.HttpserverRetryBackoff),
+		httpclient.WithRetryMaxBackoff(cfg.HttpserverRetryMaxBackoff),
+		httpclient.WithConnectionTracing(cfg.HttpserverConnTracing),
+		httpclient.WithErrorMix(cfg.HttpserverErrorMix),
+		httpclient.WithCircuitBreakerThreshold(cfg.HttpserverCircuitBreakerThreshold),
+		httpclient.WithCircuitBreakerMinRequests(cfg.HttpserverCircuitBreakerMinRequests),
+		httpclient.WithCircuitBreakerCoolDown(cfg.HttpserverCircuitBreakerCoolDown),
+		httpclient.WithLoadProfile(shape),
+		httpclient.WithStatsRecorder(recorder),
+		httpclient.WithTrafficRecorder(trafficRecorder),
+		httpclient.WithSeed(simulationSeed),
 	)
-
-	// Simulate
-	httpserverSimulator.Simulate(cfg.Users)
 }
 
-func simulateKafkaConsumer(
+func createKafkaConsumerSimulator(
 	cfg *config.SimulatorConfig,
-) {
+	shape loadprofile.Shape,
+	recorder *stats.Recorder,
+	trafficRecorder *traffic.Recorder,
+	simulationSeed int64,
+) *kafkaproducer.KafkaConsumerSimulator {
 	// Instantiate Kafka consumer simulator
-	kafkaConsumerSimulator := kafkaproducer.New(
+	return kafkaproducer.New(
 		kafkaproducer.WithServiceName(cfg.ServiceName),
 		kafkaproducer.WithRequestInterval(cfg.KafkaRequestInterval),
 		kafkaproducer.WithBrokerAddress(cfg.KafkaBrokerAddress),
 		kafkaproducer.WithBrokerTopic(cfg.KafkaTopic),
+		kafkaproducer.WithClientConfig(createKafkaClientConfig(cfg)),
+		kafkaproducer.WithTopics(createTopicSpecs(cfg)),
+		kafkaproducer.WithMaxVirtualUsers(cfg.KafkaMaxVirtualUsers),
+		kafkaproducer.WithPublishTimeout(cfg.KafkaPublishTimeout),
+		kafkaproducer.WithBatchSize(cfg.KafkaBatchSize),
+		kafkaproducer.WithPartitions(cfg.KafkaPartitions),
+		kafkaproducer.WithKeyStrategy(cfg.KafkaKeyStrategy),
+		kafkaproducer.WithHotKeyRatio(cfg.KafkaHotKeyRatio),
+		kafkaproducer.WithMessageEncoding(cfg.KafkaMessageEncoding),
+		kafkaproducer.WithProducerMode(cfg.KafkaProducerMode),
+		kafkaproducer.WithTransactionAbortRatio(cfg.KafkaTransactionAbortRatio),
+		kafkaproducer.WithSchemaRegistry(createSchemaRegistry(cfg)),
+		kafkaproducer.WithLoadProfile(shape),
+		kafkaproducer.WithStatsRecorder(recorder),
+		kafkaproducer.WithTrafficRecorder(trafficRecorder),
+		kafkaproducer.WithSeed(simulationSeed),
 	)
-
-	// Simulate
-	kafkaConsumerSimulator.Simulate(cfg.Users)
 }
@@ -0,0 +1,205 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	semconv "github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type CircuitState int64
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+type CircuitBreakerPolicy struct {
+	FailureRateThreshold float64
+	MinRequests          int
+	Window               time.Duration
+	CoolDown             time.Duration
+	HalfOpenMaxCalls     int
+}
+
+func defaultCircuitBreakerPolicy() *CircuitBreakerPolicy {
+	return &CircuitBreakerPolicy{
+		FailureRateThreshold: 0.5,
+		MinRequests:          10,
+		Window:               time.Duration(10 * time.Second),
+		CoolDown:             time.Duration(5 * time.Second),
+		HalfOpenMaxCalls:     1,
+	}
+}
+
+type circuitBreaker struct {
+	policy *CircuitBreakerPolicy
+
+	mu                sync.Mutex
+	state             CircuitState
+	generation        uint64
+	windowStart       time.Time
+	requests          int
+	failures          int
+	openedAt          time.Time
+	halfOpenInFlight  int
+	halfOpenSuccesses int
+}
+
+func newCircuitBreaker(
+	policy *CircuitBreakerPolicy,
+	meter metric.Meter,
+) *circuitBreaker {
+
+	b := &circuitBreaker{
+		policy:      policy,
+		state:       CircuitClosed,
+		windowStart: time.Now(),
+	}
+
+	// Create circuit breaker state gauge
+	_, err := meter.Int64ObservableGauge(
+		semconv.HttpClientCircuitBreakerStateName,
+		metric.WithUnit("{state}"),
+		metric.WithDescription("State of the circuit breaker (0: closed, 1: open, 2: half open)"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			o.Observe(int64(b.state))
+			return nil
+		}),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// Checks whether a call is allowed to go through. Returns the generation
+// of the state which the outcome of the call is recorded for.
+func (b *circuitBreaker) allow(
+	ctx context.Context,
+) (
+	uint64,
+	bool,
+) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.policy.CoolDown {
+			return b.generation, false
+		}
+		b.transition(ctx, CircuitHalfOpen)
+		fallthrough
+
+	case CircuitHalfOpen:
+		if b.halfOpenInFlight >= b.policy.HalfOpenMaxCalls {
+			return b.generation, false
+		}
+		b.halfOpenInFlight++
+		return b.generation, true
+
+	default:
+		return b.generation, true
+	}
+}
+
+// Records the outcome of an allowed call. Outcomes of calls which were
+// allowed before the last state change are ignored (e.g. calls which are
+// allowed while closed do not count as probes once it is half open).
+func (b *circuitBreaker) record(
+	ctx context.Context,
+	generation uint64,
+	isFailure bool,
+) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case CircuitHalfOpen:
+		b.halfOpenInFlight--
+		if isFailure {
+			b.transition(ctx, CircuitOpen)
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.policy.HalfOpenMaxCalls {
+			b.transition(ctx, CircuitClosed)
+		}
+
+	case CircuitClosed:
+		// Start a new window if the current one is expired
+		if time.Since(b.windowStart) > b.policy.Window {
+			b.resetWindow()
+		}
+
+		b.requests++
+		if isFailure {
+			b.failures++
+		}
+
+		if b.requests >= b.policy.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.policy.FailureRateThreshold {
+			b.transition(ctx, CircuitOpen)
+		}
+	}
+}
+
+// Switches to the given state and records it on the current span
+func (b *circuitBreaker) transition(
+	ctx context.Context,
+	to CircuitState,
+) {
+	from := b.state
+	b.state = to
+	b.generation++
+
+	switch to {
+	case CircuitOpen:
+		b.openedAt = time.Now()
+	case CircuitHalfOpen:
+		b.halfOpenInFlight = 0
+		b.halfOpenSuccesses = 0
+	case CircuitClosed:
+		b.resetWindow()
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("circuit_breaker.state_change",
+		trace.WithAttributes(
+			semconv.CircuitBreakerStatePrevious.String(from.String()),
+			semconv.CircuitBreakerState.String(to.String()),
+		))
+}
+
+func (b *circuitBreaker) resetWindow() {
+	b.windowStart = time.Now()
+	b.requests = 0
+	b.failures = 0
+}
@@ -0,0 +1,97 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func Test_CircuitBreakerStateTransitions(t *testing.T) {
+	ctx := context.Background()
+
+	policy := defaultCircuitBreakerPolicy()
+	policy.MinRequests = 2
+	policy.CoolDown = 10 * time.Millisecond
+	b := newCircuitBreaker(policy, noop.NewMeterProvider().Meter("test"))
+
+	// Open after failure rate exceeds threshold
+	closed, _ := b.allow(ctx)
+	b.record(ctx, closed, true)
+	b.record(ctx, closed, true)
+	if b.state != CircuitOpen {
+		t.Fatalf("Expected state %s, got %s.", CircuitOpen, b.state)
+	}
+	if _, allowed := b.allow(ctx); allowed {
+		t.Error("Calls should be short circuited while open.")
+	}
+
+	// Half open after cool down with limited probe calls
+	time.Sleep(2 * policy.CoolDown)
+	probe, allowed := b.allow(ctx)
+	if !allowed {
+		t.Error("Probe call should be allowed after cool down.")
+	}
+	if b.state != CircuitHalfOpen {
+		t.Fatalf("Expected state %s, got %s.", CircuitHalfOpen, b.state)
+	}
+	if _, allowed := b.allow(ctx); allowed {
+		t.Error("Only one probe call should be allowed while half open.")
+	}
+
+	// Calls which were allowed while closed do not count as probes
+	b.record(ctx, closed, true)
+	if b.state != CircuitHalfOpen || b.halfOpenInFlight != 1 {
+		t.Fatalf("Outcome of a call allowed while closed should be ignored, got state %s.", b.state)
+	}
+
+	// Close after successful probe
+	b.record(ctx, probe, false)
+	if b.state != CircuitClosed {
+		t.Fatalf("Expected state %s, got %s.", CircuitClosed, b.state)
+	}
+}
+
+func Test_ShortCircuitedWhenServerFails(t *testing.T) {
+
+	numCalls := 0
+	mockServer := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				numCalls++
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+	defer mockServer.Close()
+
+	httpClient := New(
+		WithCircuitBreaker(0.5, 2, time.Minute),
+	)
+
+	for i := 0; i < 5; i++ {
+		req, err := http.NewRequest(http.MethodGet, mockServer.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := httpClient.Do(context.Background(), req, "HTTP GET")
+		if i < 2 {
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			continue
+		}
+
+		if !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Expected call %d to be short circuited.", i)
+		}
+	}
+
+	if numCalls != 2 {
+		t.Errorf("Expected 2 calls to reach the server, got %d.", numCalls)
+	}
+}
@@ -2,26 +2,39 @@ package http
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
 	"time"
 
 	semconv "github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel/semconv/v1.24.0"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type Opts struct {
-	Timeout time.Duration
+	Timeout           time.Duration
+	RetryPolicy       *RetryPolicy
+	ConnectionTracing ConnectionTracing
+	CircuitBreaker    *CircuitBreakerPolicy
 }
 
 type OptFunc func(*Opts)
 
 func defaultOpts() *Opts {
 	return &Opts{
-		Timeout: time.Duration(30 * time.Second),
+		Timeout:           time.Duration(30 * time.Second),
+		RetryPolicy:       defaultRetryPolicy(),
+		ConnectionTracing: ConnectionTracingNone,
 	}
 }
 
@@ -35,6 +48,8 @@ type HttpClient struct {
 	propagator propagation.TextMapPropagator
 
 	latency metric.Float64Histogram
+	pool    *connectionPool
+	breaker *circuitBreaker
 }
 
 func New(
@@ -73,7 +88,21 @@ func New(
 		panic(err)
 	}
 
+	// Keep track of the connection pool only if connection tracing is enabled
+	var pool *connectionPool
+	if opts.ConnectionTracing != ConnectionTracingNone {
+		pool = newConnectionPool(meter)
+		c.Transport = pool.newTransport()
+	}
+
+	// Guard the calls with a circuit breaker only if it is configured
+	var breaker *circuitBreaker
+	if opts.CircuitBreaker != nil {
+		breaker = newCircuitBreaker(opts.CircuitBreaker, meter)
+	}
+
 	return &HttpClient{
+		Opts:   opts,
 		client: c,
 
 		tracer:     tracer,
@@ -81,6 +110,8 @@ func New(
 		propagator: propagator,
 
 		latency: latency,
+		pool:    pool,
+		breaker: breaker,
 	}
 }
 
@@ -91,6 +122,50 @@ func WithTimeout(timeout time.Duration) OptFunc {
 	}
 }
 
+// Configure retry policy of the HTTP client
+func WithRetryPolicy(
+	maxAttempts int,
+	initialBackoff time.Duration,
+	maxBackoff time.Duration,
+) OptFunc {
+	return func(opts *Opts) {
+		opts.RetryPolicy.MaxAttempts = maxAttempts
+		opts.RetryPolicy.InitialBackoff = initialBackoff
+		opts.RetryPolicy.MaxBackoff = maxBackoff
+	}
+}
+
+// Configure seed of the retry jitter of the requests which do not bring
+// their own randomizer
+func WithSeed(seed int64) OptFunc {
+	return func(opts *Opts) {
+		opts.RetryPolicy.randomizer = rand.New(rand.NewSource(seed))
+	}
+}
+
+// Configure connection level tracing (DNS, connect, TLS, connection
+// reuse & first byte) together with the connection pool metrics
+func WithConnectionTracing(mode ConnectionTracing) OptFunc {
+	return func(opts *Opts) {
+		opts.ConnectionTracing = mode
+	}
+}
+
+// Configure circuit breaker of the HTTP client which opens when the
+// failure rate exceeds the threshold and is half opened after the cool down
+func WithCircuitBreaker(
+	failureRateThreshold float64,
+	minRequests int,
+	coolDown time.Duration,
+) OptFunc {
+	return func(opts *Opts) {
+		opts.CircuitBreaker = defaultCircuitBreakerPolicy()
+		opts.CircuitBreaker.FailureRateThreshold = failureRateThreshold
+		opts.CircuitBreaker.MinRequests = minRequests
+		opts.CircuitBreaker.CoolDown = coolDown
+	}
+}
+
 func (c *HttpClient) Do(
 	ctx context.Context,
 	req *http.Request,
@@ -98,11 +173,78 @@ func (c *HttpClient) Do(
 ) (
 	*http.Response,
 	error,
+) {
+	// Without retries, the single attempt is the whole operation
+	policy := c.Opts.RetryPolicy
+	if policy.MaxAttempts <= 1 {
+		return c.doAttempt(ctx, req, spanName, 0)
+	}
+
+	// Start logical span which covers all of the attempts
+	ctx, span := c.tracer.Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindInternal),
+	)
+	defer span.End()
+
+	var res *http.Response
+	var err error
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+
+		if attempt > 0 {
+			backoff := policy.backoff(ctx, attempt, res)
+
+			// Discard the response of the previous attempt
+			if res != nil {
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+				res = nil
+			}
+
+			span.AddEvent("retry", trace.WithAttributes(
+				semconv.HttpRequestResendCount.Int(attempt),
+				semconv.HttpRetryBackoff.Int64(backoff.Milliseconds()),
+			))
+
+			if err = wait(ctx, backoff); err != nil {
+				break
+			}
+
+			// Rewind the request body for the next attempt
+			if req.GetBody != nil {
+				req.Body, err = req.GetBody()
+				if err != nil {
+					break
+				}
+			}
+		}
+
+		res, err = c.doAttempt(ctx, req, spanName, attempt)
+		if !policy.shouldRetry(ctx, res, err) {
+			break
+		}
+	}
+
+	setSpanStatus(span, res, err)
+	return res, err
+}
+
+// Performs a single attempt of the request within its own client span
+func (c *HttpClient) doAttempt(
+	ctx context.Context,
+	req *http.Request,
+	spanName string,
+	resendCount int,
+) (
+	*http.Response,
+	error,
 ) {
 	requestStartTime := time.Now()
 
 	// Parse HTTP attributes from the request for both span and metrics
-	spanAttrs, metricAttrs := c.getSpanAndMetricServerAttributes(req)
+	spanAttrs, metricAttrs := c.getSpanAndMetricClientAttributes(req)
+	if resendCount > 0 {
+		spanAttrs = append(spanAttrs, semconv.HttpRequestResendCount.Int(resendCount))
+	}
 
 	// Create span options
 	spanOpts := []trace.SpanStartOption{
@@ -110,43 +252,108 @@ func (c *HttpClient) Do(
 		trace.WithAttributes(spanAttrs...),
 	}
 
-	// Start HTTP server span
+	// Start HTTP client span
 	ctx, span := c.tracer.Start(ctx, spanName, spanOpts...)
 	defer span.End()
 
+	// Short circuit the call if the circuit breaker does not allow it
+	var generation uint64
+	if c.breaker != nil {
+		var allowed bool
+		generation, allowed = c.breaker.allow(ctx)
+		if !allowed {
+			span.SetAttributes(semconv.ErrorType.String("circuit_open"))
+			setSpanStatus(span, nil, ErrCircuitOpen)
+			return nil, ErrCircuitOpen
+		}
+	}
+
 	// Inject context into the HTTP headers
-	headers := http.Header{}
-	carrier := propagation.HeaderCarrier(headers)
-	otel.GetTextMapPropagator().Inject(ctx, carrier)
-	for k, v := range headers {
-		req.Header.Add(k, v[0])
+	c.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	// Trace the underlying connection of the attempt
+	reqCtx := ctx
+	if c.pool != nil {
+		reqCtx = withConnectionTracing(ctx, c.tracer, c.Opts.ConnectionTracing, c.pool)
 	}
 
-	res, err := c.client.Do(req)
+	res, err := c.client.Do(req.WithContext(reqCtx))
 
-	// Add HTTP status code to the attributes
-	span.SetAttributes(semconv.HttpResponseStatusCode.Int(res.StatusCode))
-	metricAttrs = append(metricAttrs, semconv.HttpResponseStatusCode.Int(res.StatusCode))
+	// Add HTTP status code or error type to the attributes
+	if err != nil {
+		span.SetAttributes(semconv.ErrorType.String(errorType(err)))
+		metricAttrs = append(metricAttrs, semconv.ErrorType.String(errorType(err)))
+	} else {
+		span.SetAttributes(semconv.HttpResponseStatusCode.Int(res.StatusCode))
+		metricAttrs = append(metricAttrs, semconv.HttpResponseStatusCode.Int(res.StatusCode))
+		if res.StatusCode >= http.StatusBadRequest {
+			span.SetAttributes(semconv.ErrorType.String(strconv.Itoa(res.StatusCode)))
+			metricAttrs = append(metricAttrs, semconv.ErrorType.String(strconv.Itoa(res.StatusCode)))
+		}
+	}
+	setSpanStatus(span, res, err)
+
+	// Feed the outcome into the circuit breaker
+	if c.breaker != nil {
+		c.breaker.record(ctx, generation, err != nil || res.StatusCode >= http.StatusInternalServerError)
+	}
 
 	// Create metric options
 	metricOpts := metric.WithAttributes(metricAttrs...)
 
-	// Record server latency
+	// Record client latency
 	elapsedTime := float64(time.Since(requestStartTime)) / float64(time.Millisecond)
 	c.latency.Record(ctx, elapsedTime, metricOpts)
 
 	return res, err
 }
 
-func (m *HttpClient) getSpanAndMetricServerAttributes(
+// Sets the span status according to the outcome of the request
+func setSpanStatus(
+	span trace.Span,
+	res *http.Response,
+	err error,
+) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	if res != nil && res.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, res.Status)
+	}
+}
+
+// Returns a low cardinality type of the given error
+func errorType(
+	err error,
+) string {
+	if errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) {
+		return "timeout"
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Sprintf("%T", urlErr.Err)
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+func (m *HttpClient) getSpanAndMetricClientAttributes(
 	r *http.Request,
 ) (
 	[]attribute.KeyValue,
 	[]attribute.KeyValue,
 ) {
-	spanAttrs := semconv.WithHttpServerAttributes(r)
-	metricAttrs := make([]attribute.KeyValue, len(spanAttrs))
-
-	copy(metricAttrs, spanAttrs)
+	spanAttrs := semconv.WithHttpClientAttributes(r)
+	metricAttrs := make([]attribute.KeyValue, 0, len(spanAttrs))
+
+	// Full URL is not added to metrics because of its high cardinality
+	for _, attr := range spanAttrs {
+		if attr.Key != semconv.UrlFull {
+			metricAttrs = append(metricAttrs, attr)
+		}
+	}
 	return spanAttrs, metricAttrs
 }
@@ -0,0 +1,332 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	semconv "github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ConnectionTracing string
+
+const (
+	// No connection level tracing
+	ConnectionTracingNone ConnectionTracing = ""
+
+	// DNS, connect, TLS, connection reuse & first byte as span events
+	ConnectionTracingEvents ConnectionTracing = "events"
+
+	// DNS, connect & TLS as child spans, the rest as span events
+	ConnectionTracingSpans ConnectionTracing = "spans"
+)
+
+// Collects the lifecycle of the connections in the pool as metrics
+type connectionPool struct {
+	openConnections    metric.Int64UpDownCounter
+	connectionDuration metric.Float64Histogram
+	acquisitions       metric.Int64Counter
+}
+
+func newConnectionPool(
+	meter metric.Meter,
+) *connectionPool {
+
+	openConnections, err := meter.Int64UpDownCounter(
+		semconv.HttpClientOpenConnectionsName,
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("Number of open connections in the pool"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	connectionDuration, err := meter.Float64Histogram(
+		semconv.HttpClientConnectionDurationName,
+		metric.WithUnit("ms"),
+		metric.WithDescription("Measures how long the connections were open"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	acquisitions, err := meter.Int64Counter(
+		semconv.HttpClientConnectionAcquisitionName,
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("Number of connections acquired from the pool"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &connectionPool{
+		openConnections:    openConnections,
+		connectionDuration: connectionDuration,
+		acquisitions:       acquisitions,
+	}
+}
+
+// Creates a transport which keeps track of the opened and closed connections
+func (p *connectionPool) newTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(
+		ctx context.Context,
+		network string,
+		addr string,
+	) (
+		net.Conn,
+		error,
+	) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		serverAddress, serverPort := splitHostPort(addr)
+		attrs := metric.WithAttributes(
+			semconv.ServerAddress.String(serverAddress),
+			semconv.ServerPort.Int(serverPort),
+		)
+		p.openConnections.Add(ctx, 1, attrs)
+
+		return &trackedConn{
+			Conn:     conn,
+			pool:     p,
+			attrs:    attrs,
+			openedAt: time.Now(),
+		}, nil
+	}
+	return transport
+}
+
+type trackedConn struct {
+	net.Conn
+
+	pool      *connectionPool
+	attrs     metric.MeasurementOption
+	openedAt  time.Time
+	closeOnce sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		ctx := context.Background()
+		elapsedTime := float64(time.Since(c.openedAt)) / float64(time.Millisecond)
+		c.pool.openConnections.Add(ctx, -1, c.attrs)
+		c.pool.connectionDuration.Record(ctx, elapsedTime, c.attrs)
+	})
+	return c.Conn.Close()
+}
+
+// Translates the low level connection callbacks into span events or spans
+type connectionTracer struct {
+	ctx    context.Context
+	span   trace.Span
+	tracer trace.Tracer
+	mode   ConnectionTracing
+	pool   *connectionPool
+
+	mu           sync.Mutex
+	dnsSpan      trace.Span
+	connectSpans map[string]trace.Span
+	tlsSpan      trace.Span
+}
+
+// Wraps the context of the given attempt span with a client trace
+func withConnectionTracing(
+	ctx context.Context,
+	tracer trace.Tracer,
+	mode ConnectionTracing,
+	pool *connectionPool,
+) context.Context {
+	t := &connectionTracer{
+		ctx:          ctx,
+		span:         trace.SpanFromContext(ctx),
+		tracer:       tracer,
+		mode:         mode,
+		pool:         pool,
+		connectSpans: map[string]trace.Span{},
+	}
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:             t.dnsStart,
+		DNSDone:              t.dnsDone,
+		ConnectStart:         t.connectStart,
+		ConnectDone:          t.connectDone,
+		TLSHandshakeStart:    t.tlsHandshakeStart,
+		TLSHandshakeDone:     t.tlsHandshakeDone,
+		GotConn:              t.gotConn,
+		GotFirstResponseByte: t.gotFirstResponseByte,
+	})
+}
+
+func (t *connectionTracer) dnsStart(
+	info httptrace.DNSStartInfo,
+) {
+	attrs := []attribute.KeyValue{
+		semconv.DnsQuestionName.String(info.Host),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dnsSpan = t.start("dns.start", "DNS lookup", attrs)
+}
+
+func (t *connectionTracer) dnsDone(
+	info httptrace.DNSDoneInfo,
+) {
+	addrs := make([]string, 0, len(info.Addrs))
+	for _, addr := range info.Addrs {
+		addrs = append(addrs, addr.String())
+	}
+	attrs := []attribute.KeyValue{
+		semconv.DnsAddresses.StringSlice(addrs),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.end(t.dnsSpan, "dns.done", attrs, info.Err)
+	t.dnsSpan = nil
+}
+
+func (t *connectionTracer) connectStart(
+	network string,
+	addr string,
+) {
+	attrs := []attribute.KeyValue{
+		semconv.NetworkTransport.String(network),
+		semconv.NetworkPeerAddress.String(addr),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connectSpans[addr] = t.start("connect.start", "connect", attrs)
+}
+
+func (t *connectionTracer) connectDone(
+	network string,
+	addr string,
+	err error,
+) {
+	attrs := []attribute.KeyValue{
+		semconv.NetworkTransport.String(network),
+		semconv.NetworkPeerAddress.String(addr),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.end(t.connectSpans[addr], "connect.done", attrs, err)
+	delete(t.connectSpans, addr)
+}
+
+func (t *connectionTracer) tlsHandshakeStart() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tlsSpan = t.start("tls.start", "TLS handshake", nil)
+}
+
+func (t *connectionTracer) tlsHandshakeDone(
+	state tls.ConnectionState,
+	err error,
+) {
+	attrs := []attribute.KeyValue{
+		semconv.TlsResumed.Bool(state.DidResume),
+		semconv.TlsProtocolVersion.String(tls.VersionName(state.Version)),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.end(t.tlsSpan, "tls.done", attrs, err)
+	t.tlsSpan = nil
+}
+
+func (t *connectionTracer) gotConn(
+	info httptrace.GotConnInfo,
+) {
+	t.span.AddEvent("connection.acquired", trace.WithAttributes(
+		semconv.HttpConnectionReused.Bool(info.Reused),
+		semconv.HttpConnectionWasIdle.Bool(info.WasIdle),
+		semconv.HttpConnectionIdleTime.Int64(info.IdleTime.Milliseconds()),
+	))
+
+	t.pool.acquisitions.Add(t.ctx, 1, metric.WithAttributes(
+		semconv.HttpConnectionReused.Bool(info.Reused),
+	))
+}
+
+func (t *connectionTracer) gotFirstResponseByte() {
+	t.span.AddEvent("first_byte")
+}
+
+// Starts a child span or adds a span event depending on the mode
+func (t *connectionTracer) start(
+	eventName string,
+	spanName string,
+	attrs []attribute.KeyValue,
+) trace.Span {
+	if t.mode != ConnectionTracingSpans {
+		t.span.AddEvent(eventName, trace.WithAttributes(attrs...))
+		return nil
+	}
+
+	_, span := t.tracer.Start(t.ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...),
+	)
+	return span
+}
+
+// Ends the child span or adds a span event depending on the mode
+func (t *connectionTracer) end(
+	span trace.Span,
+	eventName string,
+	attrs []attribute.KeyValue,
+	err error,
+) {
+	if span == nil {
+		if err != nil {
+			attrs = append(attrs, semconv.ErrorType.String(errorType(err)))
+		}
+		t.span.AddEvent(eventName, trace.WithAttributes(attrs...))
+		return
+	}
+
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Splits the dialed address into host & port
+func splitHostPort(
+	addr string,
+) (
+	string,
+	int,
+) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+
+	p, err := net.LookupPort("tcp", port)
+	if err != nil {
+		return host, 0
+	}
+	return host, p
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Records the spans in memory & restores the global tracer provider
+// after the test
+func newSpanRecorder(
+	t *testing.T,
+) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		tp.Shutdown(context.Background())
+	})
+	return sr
+}
+
+func Test_ConnectionEventsRecorded(t *testing.T) {
+
+	// Record spans in memory
+	sr := newSpanRecorder(t)
+
+	mockServer := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+	defer mockServer.Close()
+
+	httpClient := New(
+		WithConnectionTracing(ConnectionTracingEvents),
+	)
+
+	req, err := http.NewRequest(http.MethodGet, mockServer.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := httpClient.Do(context.Background(), req, "HTTP GET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d.", len(spans))
+	}
+
+	events := map[string]bool{}
+	for _, event := range spans[0].Events() {
+		events[event.Name] = true
+	}
+
+	for _, name := range []string{"connect.start", "connect.done", "connection.acquired", "first_byte"} {
+		if !events[name] {
+			t.Errorf("Event %s is not recorded.", name)
+		}
+	}
+}
+
+func Test_ConnectionSpansRecorded(t *testing.T) {
+
+	// Record spans in memory
+	sr := newSpanRecorder(t)
+
+	mockServer := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+	defer mockServer.Close()
+
+	httpClient := New(
+		WithConnectionTracing(ConnectionTracingSpans),
+	)
+
+	req, err := http.NewRequest(http.MethodGet, mockServer.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := httpClient.Do(context.Background(), req, "HTTP GET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	isConnectSpanRecorded := false
+	for _, span := range sr.Ended() {
+		if span.Name() == "connect" {
+			isConnectSpanRecorded = true
+		}
+	}
+	if !isConnectSpanRecorded {
+		t.Error("Connect span is not recorded.")
+	}
+}
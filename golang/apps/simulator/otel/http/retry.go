@@ -0,0 +1,156 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+
+	randomizerMu sync.Mutex
+	randomizer   *rand.Rand
+}
+
+type jitterRandomizerKey struct{}
+
+// Puts the randomizer which the retry jitter of the request is drawn from
+// into the context. The jitter is reproducible if the randomizer is
+// prepared in the order of the schedule. Otherwise, it is drawn from the
+// randomizer of the retry policy which the concurrent requests share.
+func ContextWithJitterRandomizer(
+	ctx context.Context,
+	randomizer *rand.Rand,
+) context.Context {
+	return context.WithValue(ctx, jitterRandomizerKey{}, randomizer)
+}
+
+func defaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    1,
+		InitialBackoff: time.Duration(100 * time.Millisecond),
+		MaxBackoff:     time.Duration(5 * time.Second),
+		Multiplier:     2,
+		Jitter:         0.2,
+
+		randomizer: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Checks whether the outcome of an attempt is worth retrying
+func (p *RetryPolicy) shouldRetry(
+	ctx context.Context,
+	res *http.Response,
+	err error,
+) bool {
+
+	// Do not retry if the caller is not waiting anymore
+	if ctx.Err() != nil {
+		return false
+	}
+
+	// Network errors
+	if err != nil {
+		return !errors.Is(err, ErrCircuitOpen) &&
+			!errors.Is(err, context.Canceled) &&
+			!errors.Is(err, context.DeadlineExceeded)
+	}
+
+	// Server errors & throttling
+	return res.StatusCode >= http.StatusInternalServerError ||
+		res.StatusCode == http.StatusTooManyRequests
+}
+
+// Calculates how long to wait before the given attempt. The server's
+// Retry-After header has precedence over the exponential backoff but
+// both are capped at the max backoff.
+func (p *RetryPolicy) backoff(
+	ctx context.Context,
+	attempt int,
+	res *http.Response,
+) time.Duration {
+
+	if res != nil {
+		if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+			return min(retryAfter, p.MaxBackoff)
+		}
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	// Spread the retries of the concurrent callers
+	return time.Duration(backoff + backoff*p.Jitter*(2*p.random(ctx)-1))
+}
+
+// Draws a random number in [0, 1) from the randomizer of the request if
+// there is any or from the shared one
+func (p *RetryPolicy) random(
+	ctx context.Context,
+) float64 {
+	if randomizer, ok := ctx.Value(jitterRandomizerKey{}).(*rand.Rand); ok {
+		return randomizer.Float64()
+	}
+
+	p.randomizerMu.Lock()
+	defer p.randomizerMu.Unlock()
+	return p.randomizer.Float64()
+}
+
+// Parses the Retry-After header which is either given in
+// seconds or as an HTTP date
+func parseRetryAfter(
+	value string,
+) (
+	time.Duration,
+	bool,
+) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// Waits for the given duration unless the context is cancelled
+func wait(
+	ctx context.Context,
+	d time.Duration,
+) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel"
+)
+
+func Test_RetriedUntilSuccess(t *testing.T) {
+
+	mockCtx := context.Background()
+
+	// Create tracer provider
+	tp := otel.NewTraceProvider(mockCtx)
+	defer otel.ShutdownTraceProvider(mockCtx, tp)
+
+	// Create a mock HTTP server which fails the first 2 calls
+	numCalls := 0
+	mockServer := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				numCalls++
+				if numCalls < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+	defer mockServer.Close()
+
+	httpClient := New(
+		WithTimeout(time.Duration(10*time.Second)),
+		WithRetryPolicy(3, time.Millisecond, 10*time.Millisecond),
+	)
+
+	req, err := http.NewRequest(http.MethodGet, mockServer.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := httpClient.Do(mockCtx, req, fmt.Sprintf("HTTP %s", req.Method))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Error("HTTP status code is not the one of the last attempt.")
+	}
+	if numCalls != 3 {
+		t.Errorf("Expected 3 attempts, got %d.", numCalls)
+	}
+}
+
+func Test_NotRetriedOnClientError(t *testing.T) {
+
+	mockCtx := context.Background()
+
+	// Create tracer provider
+	tp := otel.NewTraceProvider(mockCtx)
+	defer otel.ShutdownTraceProvider(mockCtx, tp)
+
+	numCalls := 0
+	mockServer := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				numCalls++
+				w.WriteHeader(http.StatusBadRequest)
+			}))
+	defer mockServer.Close()
+
+	httpClient := New(
+		WithRetryPolicy(3, time.Millisecond, 10*time.Millisecond),
+	)
+
+	req, err := http.NewRequest(http.MethodGet, mockServer.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient.Do(mockCtx, req, fmt.Sprintf("HTTP %s", req.Method))
+	if numCalls != 1 {
+		t.Errorf("Expected 1 attempt, got %d.", numCalls)
+	}
+}
+
+func Test_RetryAfterParsedCorrectly(t *testing.T) {
+
+	wait, ok := parseRetryAfter("2")
+	if !ok || wait != 2*time.Second {
+		t.Error("Retry-After in seconds is parsed incorrectly.")
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	wait, ok = parseRetryAfter(date)
+	if !ok || wait <= 0 || wait > time.Minute {
+		t.Error("Retry-After as HTTP date is parsed incorrectly.")
+	}
+
+	_, ok = parseRetryAfter("invalid")
+	if ok {
+		t.Error("Invalid Retry-After should be ignored.")
+	}
+}
+
+func Test_RetryAfterCappedAtMaxBackoff(t *testing.T) {
+	policy := defaultRetryPolicy()
+	res := &http.Response{Header: http.Header{"Retry-After": []string{"3600"}}}
+
+	if backoff := policy.backoff(context.Background(), 1, res); backoff != policy.MaxBackoff {
+		t.Errorf("Expected Retry-After to be capped at %s, got %s.", policy.MaxBackoff, backoff)
+	}
+}
+
+func Test_JitterDrawnFromRandomizerOfRequest(t *testing.T) {
+	policy := defaultRetryPolicy()
+
+	backoff := func(seed int64) time.Duration {
+		ctx := ContextWithJitterRandomizer(context.Background(), rand.New(rand.NewSource(seed)))
+		return policy.backoff(ctx, 1, nil)
+	}
+
+	// Draws from the shared randomizer in between do not change it
+	first := backoff(7)
+	policy.backoff(context.Background(), 1, nil)
+	if second := backoff(7); first != second {
+		t.Errorf("Expected the same jitter for the same randomizer, got %s & %s.", first, second)
+	}
+}
@@ -2,31 +2,86 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/IBM/sarama"
 	semconv "github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel/semconv/v1.24.0"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
+var (
+	ErrPublishTimeout     = errors.New("publish timed out")
+	ErrTransactionAborted = errors.New("transaction aborted")
+)
+
+type Opts struct {
+	PublishTimeout  time.Duration
+	ProducerMode    string
+	TransactionalId string
+}
+
+type OptFunc func(*Opts)
+
+func defaultOpts() *Opts {
+	return &Opts{
+		PublishTimeout: time.Duration(10 * time.Second),
+	}
+}
+
 type KafkaProducer struct {
+	Opts *Opts
+
 	producer sarama.AsyncProducer
 
 	tracer     trace.Tracer
 	meter      metric.Meter
 	propagator propagation.TextMapPropagator
 
-	latency metric.Float64Histogram
+	latency            metric.Float64Histogram
+	failures           metric.Int64Counter
+	transactionLatency metric.Float64Histogram
+
+	// Transactions of a producer cannot overlap
+	txnMu sync.Mutex
 }
 
+// Keeps track of a message until its own ack arrives or it times out
+type inflightMessage struct {
+	ctx       context.Context
+	span      trace.Span
+	startTime time.Time
+	metadata  interface{}
+	attrs     []attribute.KeyValue
+	done      chan error
+	timer     *time.Timer
+	once      sync.Once
+}
+
+// Wraps the given async producer which must return its successes. The
+// wrapper takes over reading the successes & the errors of the producer.
 func New(
 	producer sarama.AsyncProducer,
+	optFuncs ...OptFunc,
 ) *KafkaProducer {
 
+	// Instantiate options with default values
+	opts := defaultOpts()
+
+	// Apply external options
+	for _, f := range optFuncs {
+		f(opts)
+	}
+
 	// Instantiate trace provider
 	tracer := otel.GetTracerProvider().Tracer(semconv.KafkaProducerName)
 
@@ -47,45 +102,410 @@ func New(
 		panic(err)
 	}
 
-	return &KafkaProducer{
+	// Create producer failures counter
+	failures, err := meter.Int64Counter(
+		semconv.MessagingProducerFailuresName,
+		metric.WithUnit("{message}"),
+		metric.WithDescription("Number of messages which could not be published"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	// Create transaction latency histogram
+	transactionLatency, err := meter.Float64Histogram(
+		semconv.MessagingTransactionLatencyName,
+		metric.WithUnit("ms"),
+		metric.WithDescription("Measures the duration of transactions from begin to commit or abort"),
+		metric.WithExplicitBucketBoundaries(semconv.MessagingExplicitBucketBoundaries...),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	k := &KafkaProducer{
+		Opts: opts,
+
 		producer: producer,
 
 		tracer:     tracer,
 		meter:      meter,
 		propagator: propagator,
 
-		latency: latency,
+		latency:            latency,
+		failures:           failures,
+		transactionLatency: transactionLatency,
+	}
+
+	// Complete the messages as their acks arrive
+	go k.handleSuccesses()
+	go k.handleErrors()
+
+	return k
+}
+
+// Configure max duration to wait for the ack of a message
+func WithPublishTimeout(timeout time.Duration) OptFunc {
+	if timeout < 1 {
+		panic("publish timeout must be at least 1ns")
+	}
+	return func(opts *Opts) {
+		opts.PublishTimeout = timeout
+	}
+}
+
+// Configure mode of the producer (e.g. idempotent) which is recorded on
+// the spans & metrics to compare the modes
+func WithProducerMode(mode string) OptFunc {
+	return func(opts *Opts) {
+		opts.ProducerMode = mode
 	}
 }
 
+// Configure transactional id of the producer which is recorded on the
+// transaction spans
+func WithTransactionalId(transactionalId string) OptFunc {
+	return func(opts *Opts) {
+		opts.TransactionalId = transactionalId
+	}
+}
+
+// Publishes the message & waits until it is acknowledged
 func (k *KafkaProducer) Publish(
 	ctx context.Context,
 	msg *sarama.ProducerMessage,
-) {
+) error {
+	return <-k.PublishAsync(ctx, msg)
+}
 
-	produceStartTime := time.Now()
+// Publishes the message without waiting for it. The returned channel
+// receives the outcome of the publish once its ack arrives so that many
+// messages can be in flight at the same time. If neither an ack nor an
+// error arrives within the publish timeout, ErrPublishTimeout is returned.
+func (k *KafkaProducer) PublishAsync(
+	ctx context.Context,
+	msg *sarama.ProducerMessage,
+) <-chan error {
 
 	// Inject tracing info into message
-	span := k.createProducerSpan(ctx, msg)
+	ctx, span := k.createProducerSpan(ctx, msg)
+
+	return k.send(ctx, msg, span)
+}
+
+// Publishes the messages as a single batch & waits until all of them
+// are acknowledged. Each message gets its own creation context which
+// the batch publish span links to.
+func (k *KafkaProducer) PublishBatch(
+	ctx context.Context,
+	msgs []*sarama.ProducerMessage,
+) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	// Create & inject the creation context of every message
+	links := make([]trace.Link, 0, len(msgs))
+	for _, msg := range msgs {
+		links = append(links, trace.Link{
+			SpanContext: k.createMessageContext(ctx, msg),
+		})
+	}
+
+	// Start the batch publish span
+	ctx, span := k.tracer.Start(
+		ctx,
+		fmt.Sprintf("%s publish", msgs[0].Topic),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(k.withModeAttributes(
+			semconv.WithMessagingKafkaBatchAttributes(msgs[0].Topic, len(msgs)),
+		)...),
+		trace.WithLinks(links...),
+	)
+	defer span.End()
+
+	// Publish messages
+	results := make([]<-chan error, 0, len(msgs))
+	for _, msg := range msgs {
+		results = append(results, k.send(ctx, msg, nil))
+	}
+
+	failed, batchErr := wait(results)
+	if batchErr != nil {
+		span.SetAttributes(semconv.ErrorType.String(errorType(batchErr)))
+		span.RecordError(batchErr)
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d messages failed: %s", failed, len(msgs), batchErr.Error()))
+		return batchErr
+	}
+	return nil
+}
+
+// Publishes the messages within a single transaction & waits until all
+// of them are acknowledged. The transaction is committed if every message
+// succeeds & the commit is wanted, otherwise it is aborted. Transactions
+// of the producer run one after another.
+func (k *KafkaProducer) PublishTransaction(
+	ctx context.Context,
+	msgs []*sarama.ProducerMessage,
+	commit bool,
+) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	k.txnMu.Lock()
+	defer k.txnMu.Unlock()
+
+	// Start the transaction span which the publish spans are part of
+	startTime := time.Now()
+	attrs := semconv.WithMessagingKafkaTransactionAttributes(msgs[0].Topic, len(msgs))
+	ctx, span := k.tracer.Start(
+		ctx,
+		fmt.Sprintf("%s transaction", msgs[0].Topic),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(k.withModeAttributes(append(attrs,
+			semconv.MessagingKafkaTransactionId.String(k.Opts.TransactionalId),
+		))...),
+	)
+	defer span.End()
+
+	// Publish messages within the transaction
+	err := k.transactionStep(ctx, "begin", k.producer.BeginTxn)
+	if err == nil {
+		results := make([]<-chan error, 0, len(msgs))
+		for _, msg := range msgs {
+			results = append(results, k.PublishAsync(ctx, msg))
+		}
+		_, err = wait(results)
+	}
+
+	// Commit only if every message is acknowledged
+	if err == nil && !commit {
+		err = ErrTransactionAborted
+	}
+	if err == nil {
+		err = k.transactionStep(ctx, "commit", k.producer.CommitTxn)
+	}
+
+	outcome := semconv.MessagingKafkaTransactionCommitted
+	if err != nil {
+		outcome = semconv.MessagingKafkaTransactionAborted
+
+		// Abort the transaction unless it is not started or not abortable
+		status := k.producer.TxnStatus()
+		if status&(sarama.ProducerTxnFlagInTransaction|sarama.ProducerTxnFlagAbortableError) != 0 {
+			k.transactionStep(ctx, "abort", k.producer.AbortTxn)
+		}
+		if !errors.Is(err, ErrTransactionAborted) {
+			err = fmt.Errorf("%w: %w", ErrTransactionAborted, err)
+		}
+	}
+
+	// Record transaction latency
+	attrs = append(k.withModeAttributes(attrs), semconv.MessagingKafkaTransactionOutcome.String(outcome))
+	if err != nil {
+		attrs = append(attrs, semconv.ErrorType.String(errorType(err)))
+	}
+	elapsedTime := float64(time.Since(startTime)) / float64(time.Millisecond)
+	k.transactionLatency.Record(ctx, elapsedTime, metric.WithAttributes(attrs...))
+
+	span.SetAttributes(semconv.MessagingKafkaTransactionOutcome.String(outcome))
+	if err != nil {
+		span.SetAttributes(semconv.ErrorType.String(errorType(err)))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// Runs a boundary of the transaction (begin, commit or abort) within its
+// own span
+func (k *KafkaProducer) transactionStep(
+	ctx context.Context,
+	name string,
+	step func() error,
+) error {
+	_, span := k.tracer.Start(
+		ctx,
+		"transaction "+name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+	)
 	defer span.End()
 
-	// Publish message
-	k.producer.Input() <- msg
-	<-k.producer.Successes()
+	if err := step(); err != nil {
+		span.SetAttributes(semconv.ErrorType.String(errorType(err)))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
 
-	// Record producer latency
-	elapsedTime := float64(time.Since(produceStartTime)) / float64(time.Millisecond)
-	k.latency.Record(ctx, elapsedTime,
-		metric.WithAttributes(
-			semconv.WithMessagingKafkaProducerAttributes(msg)...,
-		))
+// Waits for every outcome & returns the number of failures with the
+// first one of them
+func wait(
+	results []<-chan error,
+) (
+	int,
+	error,
+) {
+	var firstErr error
+	failed := 0
+	for _, result := range results {
+		if err := <-result; err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return failed, firstErr
+}
+
+// Adds the producer mode to the attributes if it is configured
+func (k *KafkaProducer) withModeAttributes(
+	attrs []attribute.KeyValue,
+) []attribute.KeyValue {
+	if k.Opts.ProducerMode == "" {
+		return attrs
+	}
+	return append(attrs, semconv.MessagingKafkaProducerMode.String(k.Opts.ProducerMode))
+}
+
+// Sends the message & tracks it until its outcome arrives. The span is
+// ended with the outcome if it is given.
+func (k *KafkaProducer) send(
+	ctx context.Context,
+	msg *sarama.ProducerMessage,
+	span trace.Span,
+) <-chan error {
+
+	// Correlate the ack with the message via its metadata
+	inflight := &inflightMessage{
+		ctx:       ctx,
+		span:      span,
+		startTime: time.Now(),
+		metadata:  msg.Metadata,
+		attrs:     semconv.WithMessagingKafkaProducerAttributes(msg),
+		done:      make(chan error, 1),
+	}
+	msg.Metadata = inflight
+
+	// Give up waiting if the broker does not respond. The message is
+	// still owned by the producer, so it is not touched here.
+	inflight.timer = time.AfterFunc(k.Opts.PublishTimeout, func() {
+		k.complete(inflight, inflight.attrs, ErrPublishTimeout)
+	})
+
+	// Publish message unless the producer is blocked until the timeout
+	select {
+	case k.producer.Input() <- msg:
+	case <-inflight.done:
+		// Put the outcome back for the caller
+		inflight.done <- ErrPublishTimeout
+	}
+
+	return inflight.done
+}
+
+// Completes the acknowledged messages & hands their metadata back
+func (k *KafkaProducer) handleSuccesses() {
+	for msg := range k.producer.Successes() {
+		if inflight, ok := msg.Metadata.(*inflightMessage); ok {
+			inflight.timer.Stop()
+			msg.Metadata = inflight.metadata
+			if inflight.span != nil {
+				inflight.span.SetAttributes(semconv.WithMessagingKafkaAckAttributes(msg)...)
+			}
+			k.complete(inflight, semconv.WithMessagingKafkaProducerAttributes(msg), nil)
+		}
+	}
+}
+
+// Completes the failed messages & hands their metadata back
+func (k *KafkaProducer) handleErrors() {
+	for err := range k.producer.Errors() {
+		if inflight, ok := err.Msg.Metadata.(*inflightMessage); ok {
+			inflight.timer.Stop()
+			err.Msg.Metadata = inflight.metadata
+			k.complete(inflight, semconv.WithMessagingKafkaProducerAttributes(err.Msg), err.Err)
+		}
+	}
+}
+
+// Ends the span of the message, records its latency & notifies the
+// publisher. Only the first outcome of a message is taken into account.
+func (k *KafkaProducer) complete(
+	inflight *inflightMessage,
+	attrs []attribute.KeyValue,
+	err error,
+) {
+	inflight.once.Do(func() {
+		attrs = k.withModeAttributes(attrs)
+		if err != nil {
+			attrs = append(attrs, semconv.ErrorType.String(errorType(err)))
+			k.failures.Add(inflight.ctx, 1, metric.WithAttributes(attrs...))
+		}
+
+		if inflight.span != nil {
+			if err != nil {
+				inflight.span.SetAttributes(semconv.ErrorType.String(errorType(err)))
+				inflight.span.RecordError(err)
+				inflight.span.SetStatus(codes.Error, err.Error())
+			}
+			inflight.span.End()
+		}
+
+		// Record producer latency
+		elapsedTime := float64(time.Since(inflight.startTime)) / float64(time.Millisecond)
+		k.latency.Record(inflight.ctx, elapsedTime, metric.WithAttributes(attrs...))
+
+		inflight.done <- err
+	})
+}
+
+// Returns a low cardinality type of the producer error
+func errorType(
+	err error,
+) string {
+	if errors.Is(err, ErrPublishTimeout) || errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) {
+		return "timeout"
+	}
+
+	var kerr sarama.KError
+	if errors.As(err, &kerr) {
+		return strconv.Itoa(int(kerr))
+	}
+
+	switch {
+	case errors.Is(err, sarama.ErrOutOfBrokers):
+		return "out_of_brokers"
+	case errors.Is(err, sarama.ErrNotConnected):
+		return "not_connected"
+	case errors.Is(err, sarama.ErrShuttingDown):
+		return "shutting_down"
+	case errors.Is(err, sarama.ErrMessageTooLarge):
+		return "message_too_large"
+	case errors.Is(err, sarama.ErrTransactionNotReady), errors.Is(err, sarama.ErrTransitionNotAllowed):
+		return "transaction_not_ready"
+	case errors.Is(err, ErrTransactionAborted):
+		return "transaction_aborted"
+	}
+	return fmt.Sprintf("%T", err)
 }
 
 func (k *KafkaProducer) createProducerSpan(
 	ctx context.Context,
 	msg *sarama.ProducerMessage,
-) trace.Span {
-	spanAttrs := semconv.WithMessagingKafkaProducerAttributes(msg)
+) (
+	context.Context,
+	trace.Span,
+) {
+	spanAttrs := append(
+		k.withModeAttributes(semconv.WithMessagingKafkaProducerAttributes(msg)),
+		semconv.WithMessagingKafkaMessageKeyAttributes(msg)...,
+	)
 	spanContext, span := k.tracer.Start(
 		ctx,
 		fmt.Sprintf("%s publish", msg.Topic),
@@ -93,13 +513,42 @@ func (k *KafkaProducer) createProducerSpan(
 		trace.WithAttributes(spanAttrs...),
 	)
 
+	k.inject(spanContext, msg)
+
+	return spanContext, span
+}
+
+// Creates the context of a message within a batch, injects it into the
+// message & returns it for linking
+func (k *KafkaProducer) createMessageContext(
+	ctx context.Context,
+	msg *sarama.ProducerMessage,
+) trace.SpanContext {
+	spanContext, span := k.tracer.Start(
+		ctx,
+		fmt.Sprintf("%s create", msg.Topic),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(append(
+			semconv.WithMessagingKafkaCreateAttributes(msg),
+			semconv.WithMessagingKafkaMessageKeyAttributes(msg)...,
+		)...),
+	)
+	defer span.End()
+
+	k.inject(spanContext, msg)
+
+	return span.SpanContext()
+}
+
+// Injects the tracing info of the context into the message headers
+func (k *KafkaProducer) inject(
+	ctx context.Context,
+	msg *sarama.ProducerMessage,
+) {
 	carrier := propagation.MapCarrier{}
-	propagator := otel.GetTextMapPropagator()
-	propagator.Inject(spanContext, carrier)
+	k.propagator.Inject(ctx, carrier)
 
 	for key, value := range carrier {
 		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
 	}
-
-	return span
 }
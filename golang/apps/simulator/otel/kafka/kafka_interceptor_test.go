@@ -0,0 +1,352 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	semconv "github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestProducer(
+	t *testing.T,
+) (
+	*mocks.AsyncProducer,
+	*tracetest.SpanRecorder,
+) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	return mocks.NewAsyncProducer(t, config), sr
+}
+
+func Test_ConcurrentMessagesCompletedWithOwnAcks(t *testing.T) {
+	producer, sr := newTestProducer(t)
+
+	count := 100
+	for i := 0; i < count; i++ {
+		producer.ExpectInputAndSucceed()
+	}
+	k := New(producer)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg := &sarama.ProducerMessage{
+				Topic:    "otel",
+				Value:    sarama.StringEncoder("elon"),
+				Metadata: "original",
+			}
+			if err := k.Publish(context.Background(), msg); err != nil {
+				t.Error(err)
+			}
+			if msg.Metadata != "original" {
+				t.Error("Metadata of the caller should be restored.")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(sr.Ended()) != count {
+		t.Errorf("Expected %d ended spans, got %d.", count, len(sr.Ended()))
+	}
+	producer.Close()
+}
+
+func Test_KeyPartitionAndOffsetRecorded(t *testing.T) {
+	producer, sr := newTestProducer(t)
+
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndSucceed()
+	k := New(producer)
+
+	for i := 0; i < 2; i++ {
+		msg := &sarama.ProducerMessage{
+			Topic: "otel",
+			Key:   sarama.StringEncoder("elon"),
+			Value: sarama.StringEncoder("elon"),
+		}
+		if err := k.Publish(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spans := sr.Ended()
+	if !hasAttribute(spans[0], semconv.MessagingKafkaMessageKey, "elon") {
+		t.Error("Span should have the message key.")
+	}
+	offset := int64(-1)
+	for _, attr := range spans[1].Attributes() {
+		if attr.Key == semconv.MessagingKafkaMessageOffset {
+			offset = attr.Value.AsInt64()
+		}
+	}
+	if offset != 2 {
+		t.Errorf("Span should have the offset of the ack, got %d.", offset)
+	}
+	producer.Close()
+}
+
+func Test_FailedMessageRecordedOnItsSpan(t *testing.T) {
+	producer, sr := newTestProducer(t)
+
+	producer.ExpectInputAndFail(errors.New("broker unavailable"))
+	k := New(producer)
+
+	msg := &sarama.ProducerMessage{
+		Topic: "otel",
+		Value: sarama.StringEncoder("elon"),
+	}
+	if err := k.Publish(context.Background(), msg); err == nil {
+		t.Fatal("Publish should return the error of the producer.")
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 1 || spans[0].Status().Code != codes.Error {
+		t.Fatal("Span of the failed message should have error status.")
+	}
+	if !hasAttribute(spans[0], semconv.ErrorType, "*errors.errorString") {
+		t.Error("Span of the failed message should have the error type.")
+	}
+	producer.Close()
+}
+
+func Test_BatchPublishSpanLinkedToMessages(t *testing.T) {
+	producer, sr := newTestProducer(t)
+
+	count := 3
+	msgs := make([]*sarama.ProducerMessage, 0, count)
+	for i := 0; i < count; i++ {
+		producer.ExpectInputAndSucceed()
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: "otel",
+			Value: sarama.StringEncoder("elon"),
+		})
+	}
+	k := New(producer)
+
+	if err := k.PublishBatch(context.Background(), msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != count+1 {
+		t.Fatalf("Expected %d create spans & a publish span, got %d spans.", count, len(spans))
+	}
+
+	publish := spans[count]
+	if !hasAttribute(publish, semconv.MessagingOperation, semconv.MessagingOperationPublish) {
+		t.Error("Last span should be the batch publish span.")
+	}
+	if len(publish.Links()) != count {
+		t.Fatalf("Expected %d links, got %d.", count, len(publish.Links()))
+	}
+	for i, create := range spans[:count] {
+		if !hasAttribute(create, semconv.MessagingOperation, semconv.MessagingOperationCreate) {
+			t.Errorf("Span %d should be a create span.", i)
+		}
+		if publish.Links()[i].SpanContext.SpanID() != create.SpanContext().SpanID() {
+			t.Errorf("Publish span should link to create span %d.", i)
+		}
+	}
+	for _, attr := range publish.Attributes() {
+		if attr.Key == semconv.MessagingBatchMessageCount && attr.Value.AsInt64() != int64(count) {
+			t.Errorf("Unexpected batch message count %d.", attr.Value.AsInt64())
+		}
+	}
+	producer.Close()
+}
+
+func newTransactionalProducer(
+	t *testing.T,
+) (
+	*mocks.AsyncProducer,
+	*tracetest.SpanRecorder,
+) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	config.Version = sarama.V3_0_0_0
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Transaction.ID = "simulator"
+	config.Net.MaxOpenRequests = 1
+	return mocks.NewAsyncProducer(t, config), sr
+}
+
+func publishTransaction(
+	k *KafkaProducer,
+	count int,
+	commit bool,
+) error {
+	msgs := make([]*sarama.ProducerMessage, 0, count)
+	for i := 0; i < count; i++ {
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: "otel",
+			Value: sarama.StringEncoder("elon"),
+		})
+	}
+	return k.PublishTransaction(context.Background(), msgs, commit)
+}
+
+// Returns the ended spans by their names
+func spansByName(
+	sr *tracetest.SpanRecorder,
+) map[string]sdktrace.ReadOnlySpan {
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range sr.Ended() {
+		spans[span.Name()] = span
+	}
+	return spans
+}
+
+func Test_TransactionCommitted(t *testing.T) {
+	producer, sr := newTransactionalProducer(t)
+
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndSucceed()
+	k := New(producer, WithProducerMode("transactional"))
+
+	if err := publishTransaction(k, 2, true); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := spansByName(sr)
+	txn, ok := spans["otel transaction"]
+	if !ok || !hasAttribute(txn, semconv.MessagingKafkaTransactionOutcome, semconv.MessagingKafkaTransactionCommitted) {
+		t.Fatal("Transaction span should be committed.")
+	}
+	for _, name := range []string{"transaction begin", "transaction commit", "otel publish"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("Expected %q span.", name)
+		}
+		if span.Parent().SpanID() != txn.SpanContext().SpanID() {
+			t.Errorf("Span %q should be part of the transaction.", name)
+		}
+	}
+	if _, ok := spans["transaction abort"]; ok {
+		t.Error("Committed transaction should not be aborted.")
+	}
+	if !hasAttribute(spans["otel publish"], semconv.MessagingKafkaProducerMode, "transactional") {
+		t.Error("Publish span should have the producer mode.")
+	}
+	producer.Close()
+}
+
+func Test_TransactionAbortedOnRequest(t *testing.T) {
+	producer, sr := newTransactionalProducer(t)
+
+	producer.ExpectInputAndSucceed()
+	k := New(producer)
+
+	if err := publishTransaction(k, 1, false); !errors.Is(err, ErrTransactionAborted) {
+		t.Fatalf("Expected aborted transaction, got %v.", err)
+	}
+
+	spans := spansByName(sr)
+	txn := spans["otel transaction"]
+	if txn.Status().Code != codes.Error || !hasAttribute(txn, semconv.ErrorType, "transaction_aborted") {
+		t.Error("Aborted transaction should be recorded as error.")
+	}
+	if _, ok := spans["transaction abort"]; !ok {
+		t.Error("Expected abort span.")
+	}
+	if _, ok := spans["transaction commit"]; ok {
+		t.Error("Aborted transaction should not be committed.")
+	}
+	producer.Close()
+}
+
+func Test_TransactionAbortedOnFailedMessage(t *testing.T) {
+	producer, sr := newTransactionalProducer(t)
+
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+	k := New(producer)
+
+	err := publishTransaction(k, 2, true)
+	if !errors.Is(err, ErrTransactionAborted) || !errors.Is(err, sarama.ErrOutOfBrokers) {
+		t.Fatalf("Expected aborted transaction caused by the failed message, got %v.", err)
+	}
+
+	txn := spansByName(sr)["otel transaction"]
+	if !hasAttribute(txn, semconv.MessagingKafkaTransactionOutcome, semconv.MessagingKafkaTransactionAborted) ||
+		!hasAttribute(txn, semconv.ErrorType, "out_of_brokers") {
+		t.Error("Transaction span should have the cause of the abort.")
+	}
+	producer.Close()
+}
+
+// Never accepts any message like a producer without reachable brokers
+type blockedProducer struct {
+	sarama.AsyncProducer
+
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+}
+
+func (p *blockedProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func (p *blockedProducer) Successes() <-chan *sarama.ProducerMessage {
+	return p.successes
+}
+
+func (p *blockedProducer) Errors() <-chan *sarama.ProducerError {
+	return p.errors
+}
+
+func Test_PublishTimedOut(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	k := New(&blockedProducer{
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+	}, WithPublishTimeout(50*time.Millisecond))
+
+	msg := &sarama.ProducerMessage{
+		Topic: "otel",
+		Value: sarama.StringEncoder("elon"),
+	}
+	if err := k.Publish(context.Background(), msg); !errors.Is(err, ErrPublishTimeout) {
+		t.Fatalf("Expected publish timeout, got %v.", err)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 1 || !hasAttribute(spans[0], semconv.ErrorType, "timeout") {
+		t.Error("Span of the timed out message should have the error type timeout.")
+	}
+}
+
+func hasAttribute(
+	span sdktrace.ReadOnlySpan,
+	key attribute.Key,
+	value string,
+) bool {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key && attr.Value.AsString() == value {
+			return true
+		}
+	}
+	return false
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
@@ -21,9 +22,36 @@ import (
 
 var otelExporterType = os.Getenv("OTEL_EXPORTER_TYPE")
 
-// Creates new trace provider
+// Additional resource attributes of the simulator
+var resourceAttributes []attribute.KeyValue
+
+// Adds the given attributes to the resource of the providers which are
+// created afterwards
+func SetResourceAttributes(
+	attrs ...attribute.KeyValue,
+) {
+	resourceAttributes = append(resourceAttributes, attrs...)
+}
+
+// Creates the resource with the default SDK & the simulator attributes
+func newResource() *resource.Resource {
+	r, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			resourceAttributes...,
+		),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Creates new trace provider with the given additional span processors
 func NewTraceProvider(
 	ctx context.Context,
+	processors ...sdktrace.SpanProcessor,
 ) *sdktrace.TracerProvider {
 
 	var exp sdktrace.SpanExporter
@@ -51,23 +79,16 @@ func NewTraceProvider(
 		panic(err)
 	}
 
-	// Ensure default SDK resources and the required service name are set
-	r, err := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-		),
-	)
-	if err != nil {
-		panic(err)
-	}
-
 	// Create trace provider
-	tp := sdktrace.NewTracerProvider(
+	tpOpts := []sdktrace.TracerProviderOption{
 		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithBatcher(exp),
-		sdktrace.WithResource(r),
-	)
+		sdktrace.WithResource(newResource()),
+	}
+	for _, processor := range processors {
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(processor))
+	}
+	tpOpts = append(tpOpts, sdktrace.WithBatcher(exp))
+	tp := sdktrace.NewTracerProvider(tpOpts...)
 
 	// Set global trace provider
 	otel.SetTracerProvider(tp)
@@ -124,6 +145,7 @@ func NewMetricProvider(
 	}
 
 	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(newResource()),
 		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp)))
 	otel.SetMeterProvider(mp)
 	return mp
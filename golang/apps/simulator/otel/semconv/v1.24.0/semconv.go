@@ -3,6 +3,7 @@ package semconv
 import (
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -21,6 +22,9 @@ const (
 	ExceptionEscapedName = "exception.escaped"
 	ExceptionEscaped     = attribute.Key(ExceptionEscapedName)
 
+	ErrorTypeName = "error.type"
+	ErrorType     = attribute.Key(ErrorTypeName)
+
 	NetworkProtocolVersionName = "network.protocol.version"
 	NetworkProtocolVersion     = attribute.Key(NetworkProtocolVersionName)
 	UserAgentOriginalName      = "user_agent.original"
@@ -33,6 +37,10 @@ const (
 	ClientAddress              = attribute.Key(ClientAddressName)
 	ClientPortName             = "client.port"
 	ClientPort                 = attribute.Key(ClientPortName)
+	NetworkPeerAddressName     = "network.peer.address"
+	NetworkPeerAddress         = attribute.Key(NetworkPeerAddressName)
+	NetworkTransportName       = "network.transport"
+	NetworkTransport           = attribute.Key(NetworkTransportName)
 )
 
 // HTTP
@@ -41,13 +49,48 @@ const (
 	HttpClientName        = "http_client"
 	HttpClientLatencyName = "http.client.request.duration"
 
-	HttpMethodKeyName = "http.request.method"
-	HttpMethodKey     = attribute.Key(HttpMethodKeyName)
-	HttpSchemeKeyName = "url.scheme"
-	HttpSchemeKey     = attribute.Key(HttpSchemeKeyName)
+	HttpClientOpenConnectionsName       = "http.client.open_connections"
+	HttpClientConnectionDurationName    = "http.client.connection.duration"
+	HttpClientConnectionAcquisitionName = "http.client.connection.acquisitions"
+	HttpClientCircuitBreakerStateName   = "http.client.circuit_breaker.state"
+
+	HttpMethodKeyName         = "http.request.method"
+	HttpMethodKey             = attribute.Key(HttpMethodKeyName)
+	HttpMethodOriginalKeyName = "http.request.method_original"
+	HttpMethodOriginalKey     = attribute.Key(HttpMethodOriginalKeyName)
+	HttpSchemeKeyName         = "url.scheme"
+	HttpSchemeKey             = attribute.Key(HttpSchemeKeyName)
+	UrlFullName               = "url.full"
+	UrlFull                   = attribute.Key(UrlFullName)
 
 	HttpResponseStatusCodeName = "http.response.status_code"
 	HttpResponseStatusCode     = attribute.Key(HttpResponseStatusCodeName)
+	HttpRequestResendCountName = "http.request.resend_count"
+	HttpRequestResendCount     = attribute.Key(HttpRequestResendCountName)
+
+	// Custom attributes (not part of the semantic conventions)
+	HttpRetryBackoffName = "http.retry.backoff"
+	HttpRetryBackoff     = attribute.Key(HttpRetryBackoffName)
+
+	HttpConnectionReusedName   = "http.connection.reused"
+	HttpConnectionReused       = attribute.Key(HttpConnectionReusedName)
+	HttpConnectionWasIdleName  = "http.connection.was_idle"
+	HttpConnectionWasIdle      = attribute.Key(HttpConnectionWasIdleName)
+	HttpConnectionIdleTimeName = "http.connection.idle_time"
+	HttpConnectionIdleTime     = attribute.Key(HttpConnectionIdleTimeName)
+	DnsQuestionNameName        = "dns.question.name"
+	DnsQuestionName            = attribute.Key(DnsQuestionNameName)
+	DnsAddressesName           = "dns.addresses"
+	DnsAddresses               = attribute.Key(DnsAddressesName)
+	TlsResumedName             = "tls.resumed"
+	TlsResumed                 = attribute.Key(TlsResumedName)
+	TlsProtocolVersionName     = "tls.protocol.version"
+	TlsProtocolVersion         = attribute.Key(TlsProtocolVersionName)
+
+	CircuitBreakerStateName         = "circuit_breaker.state"
+	CircuitBreakerState             = attribute.Key(CircuitBreakerStateName)
+	CircuitBreakerStatePreviousName = "circuit_breaker.state.previous"
+	CircuitBreakerStatePrevious     = attribute.Key(CircuitBreakerStatePreviousName)
 )
 
 var (
@@ -123,6 +166,58 @@ func WithHttpServerAttributes(
 	return attrs
 }
 
+func WithHttpClientAttributes(
+	req *http.Request,
+) []attribute.KeyValue {
+
+	numAttributes := 5 // Method, scheme, proto, full URL & server address
+
+	// Get user agent
+	userAgent := req.UserAgent()
+	if userAgent != "" {
+		numAttributes++
+	}
+
+	// Get original method if it is not a known one
+	method, isKnownMethod := normalizeHttpMethod(req.Method)
+	if !isKnownMethod {
+		numAttributes++
+	}
+
+	// Get server address & port out of the URL
+	serverAddress, serverPort := serverAddressAndPort(req)
+	if serverPort > 0 {
+		numAttributes++
+	}
+
+	// Create attributes array
+	attrs := make([]attribute.KeyValue, 0, numAttributes)
+
+	// Method, scheme & protocol version
+	attrs = append(attrs, HttpMethodKey.String(method))
+	if !isKnownMethod {
+		attrs = append(attrs, HttpMethodOriginalKey.String(req.Method))
+	}
+	attrs = append(attrs, httpScheme(req.URL.Scheme == "https"))
+	attrs = append(attrs, httpNetworkProtocolVersion(req.Proto))
+
+	// Full URL without credentials
+	attrs = append(attrs, UrlFull.String(urlFull(req.URL)))
+
+	// User agent
+	if userAgent != "" {
+		attrs = append(attrs, UserAgentOriginal.String(userAgent))
+	}
+
+	// Server address & port
+	attrs = append(attrs, ServerAddress.String(serverAddress))
+	if serverPort > 0 {
+		attrs = append(attrs, ServerPort.Int(serverPort))
+	}
+
+	return attrs
+}
+
 // Parses the HTTP method
 func httpMethod(
 	method string,
@@ -133,6 +228,75 @@ func httpMethod(
 	return HttpMethodKey.String(method)
 }
 
+// Normalizes the HTTP method into one of the known methods
+// or _OTHER if it is not known
+func normalizeHttpMethod(
+	method string,
+) (
+	string,
+	bool,
+) {
+	if method == "" {
+		return http.MethodGet, true
+	}
+
+	switch method {
+	case http.MethodConnect,
+		http.MethodDelete,
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodOptions,
+		http.MethodPatch,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodTrace:
+		return method, true
+	default:
+		return "_OTHER", false
+	}
+}
+
+// Builds the full URL without the user credentials
+func urlFull(
+	u *url.URL,
+) string {
+	if u.User == nil {
+		return u.String()
+	}
+
+	redacted := *u
+	redacted.User = nil
+	return redacted.String()
+}
+
+// Parses the server address & port out of the request URL
+// and falls back to the default port of the scheme
+func serverAddressAndPort(
+	req *http.Request,
+) (
+	string,
+	int,
+) {
+	host := req.URL.Host
+	if host == "" {
+		host = req.Host
+	}
+
+	address, port := splitAddressAndPort(host)
+	if port > 0 {
+		return address, port
+	}
+
+	switch req.URL.Scheme {
+	case "http":
+		return address, 80
+	case "https":
+		return address, 443
+	default:
+		return address, port
+	}
+}
+
 // Parses the HTTP scheme
 func httpScheme(
 	isHttps bool,
@@ -203,9 +367,14 @@ func splitAddressAndPort(
 // https://github.com/open-telemetry/semantic-conventions/tree/v1.24.0/docs/messaging
 const (
 	KafkaProducerName = "kafka_producer"
+	KafkaAdminName    = "kafka_admin"
 
 	MessagingProducerLatencyName = "messaging.publish.duration"
 
+	// Custom
+	MessagingProducerFailuresName   = "messaging.publish.failures"
+	MessagingTransactionLatencyName = "messaging.transaction.duration"
+
 	MessagingSystemName          = "messaging.system"
 	MessagingSystem              = attribute.Key(MessagingSystemName)
 	MessagingOperationName       = "messaging.operation"
@@ -215,9 +384,43 @@ const (
 	MessagingDestinationNameName = "messaging.destination.name"
 	MessagingDestinationName     = attribute.Key(MessagingDestinationNameName)
 
+	MessagingBatchMessageCountName = "messaging.batch.message_count"
+	MessagingBatchMessageCount     = attribute.Key(MessagingBatchMessageCountName)
+
+	MessagingOperationPublish = "publish"
+	MessagingOperationCreate  = "create"
+
 	// KAFKA
 	MessagingKafkaDestinationPartitionName = "messaging.kafka.destination.partition"
 	MessagingKafkaDestinationPartition     = attribute.Key(MessagingKafkaDestinationPartitionName)
+	MessagingKafkaMessageKeyName           = "messaging.kafka.message.key"
+	MessagingKafkaMessageKey               = attribute.Key(MessagingKafkaMessageKeyName)
+	MessagingKafkaMessageOffsetName        = "messaging.kafka.message.offset"
+	MessagingKafkaMessageOffset            = attribute.Key(MessagingKafkaMessageOffsetName)
+
+	// Custom KAFKA
+	MessagingKafkaProducerModeName       = "messaging.kafka.producer.mode"
+	MessagingKafkaProducerMode           = attribute.Key(MessagingKafkaProducerModeName)
+	MessagingKafkaTransactionIdName      = "messaging.kafka.transaction.id"
+	MessagingKafkaTransactionId          = attribute.Key(MessagingKafkaTransactionIdName)
+	MessagingKafkaTransactionOutcomeName = "messaging.kafka.transaction.outcome"
+	MessagingKafkaTransactionOutcome     = attribute.Key(MessagingKafkaTransactionOutcomeName)
+
+	MessagingKafkaAdminOperationName       = "messaging.kafka.admin.operation"
+	MessagingKafkaAdminOperation           = attribute.Key(MessagingKafkaAdminOperationName)
+	MessagingKafkaTopicCountName           = "messaging.kafka.topic.count"
+	MessagingKafkaTopicCount               = attribute.Key(MessagingKafkaTopicCountName)
+	MessagingKafkaTopicDriftCountName      = "messaging.kafka.topic.drift_count"
+	MessagingKafkaTopicDriftCount          = attribute.Key(MessagingKafkaTopicDriftCountName)
+	MessagingKafkaTopicSettingName         = "messaging.kafka.topic.setting"
+	MessagingKafkaTopicSetting             = attribute.Key(MessagingKafkaTopicSettingName)
+	MessagingKafkaTopicSettingExpectedName = "messaging.kafka.topic.setting.expected"
+	MessagingKafkaTopicSettingExpected     = attribute.Key(MessagingKafkaTopicSettingExpectedName)
+	MessagingKafkaTopicSettingActualName   = "messaging.kafka.topic.setting.actual"
+	MessagingKafkaTopicSettingActual       = attribute.Key(MessagingKafkaTopicSettingActualName)
+
+	MessagingKafkaTransactionCommitted = "committed"
+	MessagingKafkaTransactionAborted   = "aborted"
 )
 
 var (
@@ -243,14 +446,80 @@ func WithMessagingKafkaProducerAttributes(
 	msg *sarama.ProducerMessage,
 ) []attribute.KeyValue {
 
+	return withMessagingKafkaAttributes(msg, MessagingOperationPublish)
+}
+
+// Returns the key of the message which is only added to spans because
+// of its high cardinality
+func WithMessagingKafkaMessageKeyAttributes(
+	msg *sarama.ProducerMessage,
+) []attribute.KeyValue {
+	if msg.Key == nil {
+		return nil
+	}
+
+	key, err := msg.Key.Encode()
+	if err != nil {
+		return nil
+	}
+	return []attribute.KeyValue{
+		MessagingKafkaMessageKey.String(string(key)),
+	}
+}
+
+// Returns the partition & the offset which the broker assigned to the
+// acknowledged message
+func WithMessagingKafkaAckAttributes(
+	msg *sarama.ProducerMessage,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		MessagingKafkaDestinationPartition.Int(int(msg.Partition)),
+		MessagingKafkaMessageOffset.Int64(msg.Offset),
+	}
+}
+
+func WithMessagingKafkaCreateAttributes(
+	msg *sarama.ProducerMessage,
+) []attribute.KeyValue {
+	return withMessagingKafkaAttributes(msg, MessagingOperationCreate)
+}
+
+func WithMessagingKafkaBatchAttributes(
+	topic string,
+	count int,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		MessagingSystem.String("kafka"),
+		MessagingOperation.String(MessagingOperationPublish),
+		MessagingDestinationName.String(topic),
+		MessagingBatchMessageCount.Int(count),
+	}
+}
+
+func WithMessagingKafkaTransactionAttributes(
+	topic string,
+	count int,
+) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		MessagingSystem.String("kafka"),
+		MessagingDestinationName.String(topic),
+		MessagingBatchMessageCount.Int(count),
+	}
+}
+
+func withMessagingKafkaAttributes(
+	msg *sarama.ProducerMessage,
+	operation string,
+) []attribute.KeyValue {
+
 	numAttributes := 4 // Operation, system, destination & partition
 
 	// Create attributes array
 	attrs := make([]attribute.KeyValue, 0, numAttributes)
 
-	// Method, scheme & protocol version
+	// System, operation, destination & partition
 	attrs = append(attrs, MessagingSystem.String("kafka"))
-	attrs = append(attrs, MessagingOperation.String("publish"))
+	attrs = append(attrs, MessagingOperation.String(operation))
 	attrs = append(attrs, MessagingDestinationName.String(msg.Topic))
 	attrs = append(attrs, MessagingKafkaDestinationPartition.Int(int(msg.Partition)))
 
@@ -0,0 +1,63 @@
+package population
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	UserIdName   = "user.id"
+	UserId       = attribute.Key(UserIdName)
+	UserTierName = "user.tier"
+	UserTier     = attribute.Key(UserTierName)
+)
+
+// Puts the user id & tier into the baggage so that they are propagated
+// to the downstream services
+func ContextWithUser(
+	ctx context.Context,
+	user *User,
+) context.Context {
+	id, err := baggage.NewMember(UserIdName, user.Id)
+	if err != nil {
+		return ctx
+	}
+	tier, err := baggage.NewMember(UserTierName, user.Tier)
+	if err != nil {
+		return ctx
+	}
+
+	bag := baggage.FromContext(ctx)
+	bag, _ = bag.SetMember(id)
+	bag, _ = bag.SetMember(tier)
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// Adds the user id & tier of the baggage to every started span
+type spanProcessor struct{}
+
+func NewSpanProcessor() sdktrace.SpanProcessor {
+	return &spanProcessor{}
+}
+
+func (p *spanProcessor) OnStart(
+	ctx context.Context,
+	span sdktrace.ReadWriteSpan,
+) {
+	bag := baggage.FromContext(ctx)
+	if id := bag.Member(UserIdName).Value(); id != "" {
+		span.SetAttributes(UserId.String(id))
+	}
+	if tier := bag.Member(UserTierName).Value(); tier != "" {
+		span.SetAttributes(UserTier.String(tier))
+	}
+}
+
+func (p *spanProcessor) OnEnd(_ sdktrace.ReadOnlySpan) {}
+
+func (p *spanProcessor) Shutdown(_ context.Context) error { return nil }
+
+func (p *spanProcessor) ForceFlush(_ context.Context) error { return nil }
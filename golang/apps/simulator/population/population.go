@@ -0,0 +1,218 @@
+package population
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/errormix"
+)
+
+const (
+	TierFree       = "free"
+	TierPremium    = "premium"
+	TierEnterprise = "enterprise"
+
+	DistributionUniform = "uniform"
+	DistributionZipf    = "zipf"
+)
+
+type User struct {
+	Id   string `json:"id"`
+	Tier string `json:"tier"`
+
+	// Relative activity of the user compared to the others. It is 1 if
+	// not given & users with 0 are never picked.
+	Weight float64 `json:"weight"`
+
+	// Probability that a call of the user causes an error
+	// on top of the configured error mix
+	ErrorPropensity float64 `json:"errorPropensity"`
+
+	// Error mix of the user which overrides the one of the phase
+	ErrorMix map[string]float64 `json:"errorMix,omitempty"`
+}
+
+// Decodes the user with the default weight if it is not given
+func (u *User) UnmarshalJSON(b []byte) error {
+	type user User
+	parsed := user{Weight: 1}
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		return err
+	}
+
+	*u = User(parsed)
+	return nil
+}
+
+type Population struct {
+	Users []*User `json:"users"`
+
+	cumulativeWeights []float64
+}
+
+// Loads the users from the given JSON file
+func Load(
+	path string,
+) (
+	*Population,
+	error,
+) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(content)
+}
+
+// Parses the users out of the given JSON content
+func Parse(
+	content []byte,
+) (
+	*Population,
+	error,
+) {
+	p := &Population{}
+	if err := json.Unmarshal(content, p); err != nil {
+		return nil, err
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Creates equally active users with the given names
+func FromNames(
+	names []string,
+) *Population {
+	p := &Population{
+		Users: make([]*User, 0, len(names)),
+	}
+	for _, name := range names {
+		p.Users = append(p.Users, &User{
+			Id:     name,
+			Tier:   TierFree,
+			Weight: 1,
+		})
+	}
+
+	p.validate()
+	return p
+}
+
+// Generates the given number of synthetic users. With the Zipf distribution
+// the activity of the n-th user is proportional to 1/n^exponent, the most
+// active users are put into the higher tiers.
+func Generate(
+	count int,
+	distribution string,
+	exponent float64,
+) (
+	*Population,
+	error,
+) {
+	if count <= 0 {
+		return nil, errors.New("number of users must be positive")
+	}
+
+	p := &Population{
+		Users: make([]*User, 0, count),
+	}
+	for i := 0; i < count; i++ {
+		user := &User{
+			Id:   fmt.Sprintf("user-%05d", i),
+			Tier: tierOfRank(i, count),
+		}
+
+		switch distribution {
+		case DistributionZipf:
+			user.Weight = 1 / math.Pow(float64(i+1), exponent)
+		case DistributionUniform, "":
+			user.Weight = 1
+		default:
+			return nil, fmt.Errorf("unknown user distribution %q", distribution)
+		}
+
+		p.Users = append(p.Users, user)
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Assigns the top 1% of the users to enterprise
+// and the next 10% to premium tier
+func tierOfRank(
+	rank int,
+	count int,
+) string {
+	switch {
+	case rank < int(math.Ceil(float64(count)*0.01)):
+		return TierEnterprise
+	case rank < int(math.Ceil(float64(count)*0.11)):
+		return TierPremium
+	default:
+		return TierFree
+	}
+}
+
+// Checks the users and prepares the weights for picking
+func (p *Population) validate() error {
+	if len(p.Users) == 0 {
+		return errors.New("population has no users")
+	}
+
+	p.cumulativeWeights = make([]float64, len(p.Users))
+	total := 0.0
+	for i, user := range p.Users {
+		if user.Id == "" {
+			return fmt.Errorf("user %d has no id", i)
+		}
+		if user.Tier == "" {
+			user.Tier = TierFree
+		}
+		if user.Weight < 0 {
+			return fmt.Errorf("user %s has negative weight", user.Id)
+		}
+		if err := errormix.Validate(user.ErrorMix); err != nil {
+			return fmt.Errorf("user %s has invalid error mix: %w", user.Id, err)
+		}
+
+		total += user.Weight
+		p.cumulativeWeights[i] = total
+	}
+
+	if total == 0 {
+		return errors.New("population has no user with a positive weight")
+	}
+
+	return nil
+}
+
+// Picks a user according to their weights
+func (p *Population) Pick(
+	randomizer *rand.Rand,
+) *User {
+	total := p.cumulativeWeights[len(p.cumulativeWeights)-1]
+	target := randomizer.Float64() * total
+
+	// The first user whose cumulative weight exceeds the target which
+	// skips the users without weight
+	i := sort.Search(len(p.cumulativeWeights), func(i int) bool {
+		return p.cumulativeWeights[i] > target
+	})
+	if i >= len(p.Users) {
+		i = len(p.Users) - 1
+	}
+	return p.Users[i]
+}
@@ -0,0 +1,90 @@
+package population
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+func Test_UsersPickedByWeight(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"users": [
+			{"id": "heavy", "tier": "enterprise", "weight": 9},
+			{"id": "light", "weight": 1}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	randomizer := rand.New(rand.NewSource(1))
+	picks := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		picks[p.Pick(randomizer).Id]++
+	}
+
+	if picks["heavy"] < 8500 || picks["heavy"] > 9500 {
+		t.Errorf("Expected ~9000 picks of heavy user, got %d.", picks["heavy"])
+	}
+	if p.Users[1].Tier != TierFree {
+		t.Error("Default tier is not set.")
+	}
+}
+
+func Test_WeightsDefaultedOnlyIfNotGiven(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"users": [
+			{"id": "active"},
+			{"id": "inactive", "weight": 0}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Users[0].Weight != 1 || p.Users[1].Weight != 0 {
+		t.Errorf("Expected weights 1 & 0, got %f & %f.", p.Users[0].Weight, p.Users[1].Weight)
+	}
+
+	randomizer := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		if p.Pick(randomizer).Id != "active" {
+			t.Fatal("User without weight should never be picked.")
+		}
+	}
+
+	_, err = Parse([]byte(`{"users": [{"id": "elon", "weight": -1}]}`))
+	if err == nil {
+		t.Error("Negative weight should be rejected.")
+	}
+}
+
+func Test_ZipfPopulationGenerated(t *testing.T) {
+	p, err := Generate(100, DistributionZipf, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Users) != 100 {
+		t.Fatalf("Expected 100 users, got %d.", len(p.Users))
+	}
+	if p.Users[0].Weight != 1 || p.Users[1].Weight != 0.5 {
+		t.Error("Zipf weights are calculated incorrectly.")
+	}
+	if p.Users[0].Tier != TierEnterprise ||
+		p.Users[5].Tier != TierPremium ||
+		p.Users[50].Tier != TierFree {
+		t.Error("Tiers are assigned incorrectly.")
+	}
+}
+
+func Test_UserPutIntoBaggage(t *testing.T) {
+	ctx := ContextWithUser(context.Background(), &User{Id: "elon", Tier: TierPremium})
+
+	bag := baggage.FromContext(ctx)
+	if bag.Member(UserIdName).Value() != "elon" ||
+		bag.Member(UserTierName).Value() != TierPremium {
+		t.Error("User is not put into baggage correctly.")
+	}
+}
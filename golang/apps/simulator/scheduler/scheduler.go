@@ -0,0 +1,257 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	SchedulerName = "simulator_scheduler"
+
+	IterationDurationName = "simulator.iteration.duration"
+	IterationsDroppedName = "simulator.iterations.dropped"
+	IterationsLateName    = "simulator.iterations.late"
+
+	OperationName = "simulator.operation"
+	Operation     = attribute.Key(OperationName)
+	SuccessName   = "simulator.success"
+	Success       = attribute.Key(SuccessName)
+
+	// How often a paused scheduler checks whether it should resume
+	PauseCheckInterval = time.Second
+)
+
+type Opts struct {
+	Operation       string
+	MaxVirtualUsers int
+	LateThreshold   time.Duration
+}
+
+type OptFunc func(*Opts)
+
+func defaultOpts() *Opts {
+	return &Opts{
+		MaxVirtualUsers: 50,
+		LateThreshold:   time.Duration(100 * time.Millisecond),
+	}
+}
+
+// Returns the rate of the iterations per second
+type RateFunc func() float64
+
+// Performs a single iteration
+type IterationFunc func(ctx context.Context) error
+
+// Prepares the next iteration. It is called sequentially in the order of
+// the schedule so that the randomness drawn in it is reproducible.
+type NextFunc func() IterationFunc
+
+// Dispatches iterations on a fixed schedule independent of how long
+// the previous ones take (open model) with a bounded number of virtual users
+type Scheduler struct {
+	Opts *Opts
+
+	rate RateFunc
+	next NextFunc
+	vus  chan struct{}
+
+	attrs    metric.MeasurementOption
+	duration metric.Float64Histogram
+	dropped  metric.Int64Counter
+	late     metric.Int64Counter
+}
+
+// Create a scheduler instance
+func New(
+	rate RateFunc,
+	next NextFunc,
+	optFuncs ...OptFunc,
+) *Scheduler {
+
+	// Instantiate options with default values
+	opts := defaultOpts()
+
+	// Apply external options
+	for _, f := range optFuncs {
+		f(opts)
+	}
+
+	// Without a virtual user every iteration would be dropped
+	if opts.MaxVirtualUsers < 1 {
+		panic("max virtual users must be at least 1")
+	}
+
+	// Instantiate meter provider
+	meter := otel.GetMeterProvider().Meter(SchedulerName)
+
+	// Create iteration duration histogram
+	duration, err := meter.Float64Histogram(
+		IterationDurationName,
+		metric.WithUnit("ms"),
+		metric.WithDescription("Measures the duration of iterations from their intended start time"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	// Create dropped iterations counter
+	dropped, err := meter.Int64Counter(
+		IterationsDroppedName,
+		metric.WithUnit("{iteration}"),
+		metric.WithDescription("Number of iterations dropped because all virtual users were busy"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	// Create late iterations counter
+	late, err := meter.Int64Counter(
+		IterationsLateName,
+		metric.WithUnit("{iteration}"),
+		metric.WithDescription("Number of iterations started later than the threshold after their intended start time"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Scheduler{
+		Opts: opts,
+
+		rate: rate,
+		next: next,
+		vus:  make(chan struct{}, opts.MaxVirtualUsers),
+
+		attrs:    metric.WithAttributes(Operation.String(opts.Operation)),
+		duration: duration,
+		dropped:  dropped,
+		late:     late,
+	}
+}
+
+// Configure name of the scheduled operation
+func WithOperation(operation string) OptFunc {
+	return func(opts *Opts) {
+		opts.Operation = operation
+	}
+}
+
+// Configure max number of concurrently running iterations (at least 1)
+func WithMaxVirtualUsers(maxVirtualUsers int) OptFunc {
+	return func(opts *Opts) {
+		opts.MaxVirtualUsers = maxVirtualUsers
+	}
+}
+
+// Configure delay after which an iteration is counted as late
+func WithLateThreshold(lateThreshold time.Duration) OptFunc {
+	return func(opts *Opts) {
+		opts.LateThreshold = lateThreshold
+	}
+}
+
+// Dispatches the iterations until the context is cancelled
+func (s *Scheduler) Run(
+	ctx context.Context,
+) {
+	last := time.Now()
+	var planned time.Time
+	for {
+		// Wait until there is traffic to schedule
+		rate := s.rate()
+		if rate <= 0 {
+			if !s.sleep(ctx, PauseCheckInterval) {
+				return
+			}
+			last = time.Now()
+			planned = time.Time{}
+			continue
+		}
+
+		// Schedule the next iteration relative to the previous intended
+		// start so that a slow dispatch does not lower the rate
+		next := last.Add(time.Duration(float64(time.Second) / rate))
+
+		// If the rate rose while waiting, start from now instead of
+		// catching up on the iterations which the lower rate did not owe
+		now := time.Now()
+		if next.Before(planned) && next.Before(now) {
+			next = now
+			if planned.Before(now) {
+				next = planned
+			}
+		}
+
+		// Wait at most for the pause check interval so that a low rate
+		// (e.g. at the start of a ramp) is evaluated again before dispatch
+		if wait := next.Sub(now); wait > 0 {
+			planned = next
+			if !s.sleep(ctx, min(wait, PauseCheckInterval)) {
+				return
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.dispatch(ctx, next)
+		last = next
+		planned = time.Time{}
+	}
+}
+
+// Runs the iteration on a free virtual user or drops it
+func (s *Scheduler) dispatch(
+	ctx context.Context,
+	intendedStart time.Time,
+) {
+	// Prepare the iteration even if it is dropped to keep the sequence
+	iteration := s.next()
+
+	select {
+	case s.vus <- struct{}{}:
+	default:
+		s.dropped.Add(ctx, 1, s.attrs)
+		return
+	}
+
+	go func() {
+		defer func() { <-s.vus }()
+
+		if time.Since(intendedStart) > s.Opts.LateThreshold {
+			s.late.Add(ctx, 1, s.attrs)
+		}
+
+		err := iteration(ctx)
+
+		elapsedTime := float64(time.Since(intendedStart)) / float64(time.Millisecond)
+		s.duration.Record(ctx, elapsedTime, metric.WithAttributes(
+			Operation.String(s.Opts.Operation),
+			Success.Bool(err == nil),
+		))
+	}()
+}
+
+// Sleeps for the given duration unless the context is cancelled
+func (s *Scheduler) sleep(
+	ctx context.Context,
+	d time.Duration,
+) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_IterationsDispatchedIndependentOfLatency(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	// Each iteration takes longer than the interval between them
+	var numIterations int64
+	s := New(
+		func() float64 { return 50 },
+		func() IterationFunc {
+			return func(ctx context.Context) error {
+				atomic.AddInt64(&numIterations, 1)
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			}
+		},
+		WithMaxVirtualUsers(100),
+	)
+	s.Run(ctx)
+
+	// A closed model would have made ~5 iterations
+	if n := atomic.LoadInt64(&numIterations); n < 20 {
+		t.Errorf("Expected ~25 iterations, got %d.", n)
+	}
+}
+
+func Test_IterationsDroppedWhenVirtualUsersAreBusy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	var numIterations int64
+	s := New(
+		func() float64 { return 100 },
+		func() IterationFunc {
+			return func(ctx context.Context) error {
+				atomic.AddInt64(&numIterations, 1)
+				<-ctx.Done()
+				return nil
+			}
+		},
+		WithMaxVirtualUsers(2),
+	)
+	s.Run(ctx)
+
+	if n := atomic.LoadInt64(&numIterations); n != 2 {
+		t.Errorf("Expected only 2 iterations to run, got %d.", n)
+	}
+}
+
+func Test_RateEvaluatedAgainDuringLongWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	// The first interval would be ~1000s without evaluating the rate again
+	start := time.Now()
+	var numIterations int64
+	s := New(
+		func() float64 {
+			if time.Since(start) < 200*time.Millisecond {
+				return 0.001
+			}
+			return 20
+		},
+		func() IterationFunc {
+			return func(ctx context.Context) error {
+				atomic.AddInt64(&numIterations, 1)
+				return nil
+			}
+		},
+	)
+	s.Run(ctx)
+
+	if n := atomic.LoadInt64(&numIterations); n < 5 || n > 15 {
+		t.Errorf("Expected ~10 iterations, got %d.", n)
+	}
+}
+
+func Test_MaxVirtualUsersBelowOneRejected(t *testing.T) {
+	for _, maxVirtualUsers := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Max virtual users of %d should be rejected.", maxVirtualUsers)
+				}
+			}()
+			New(
+				func() float64 { return 1 },
+				func() IterationFunc { return nil },
+				WithMaxVirtualUsers(maxVirtualUsers),
+			)
+		}()
+	}
+}
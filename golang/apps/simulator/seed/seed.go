@@ -0,0 +1,42 @@
+package seed
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	SimulatorSeedName = "simulator.seed"
+	SimulatorSeed     = attribute.Key(SimulatorSeedName)
+)
+
+// Parses the given seed or creates a time based one if it is not set
+func Parse(
+	value string,
+) int64 {
+	if value == "" {
+		return time.Now().UnixNano()
+	}
+
+	seed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		panic(err.Error())
+	}
+	return seed
+}
+
+// Creates a randomizer for the given stream (e.g. "http GET") which is
+// derived from the seed. Each stream draws its own reproducible sequence
+// regardless of how the goroutines of the other streams are scheduled.
+func NewRandomizer(
+	seed int64,
+	stream string,
+) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(stream))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+}
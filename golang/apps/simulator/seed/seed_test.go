@@ -0,0 +1,33 @@
+package seed
+
+import "testing"
+
+func Test_RandomizersReproducible(t *testing.T) {
+	first := NewRandomizer(42, "http GET")
+	second := NewRandomizer(42, "http GET")
+	other := NewRandomizer(42, "http DELETE")
+
+	isOtherDifferent := false
+	for i := 0; i < 10; i++ {
+		value := first.Int63()
+		if value != second.Int63() {
+			t.Fatal("Same seed & stream should draw the same sequence.")
+		}
+		if value != other.Int63() {
+			isOtherDifferent = true
+		}
+	}
+
+	if !isOtherDifferent {
+		t.Error("Different streams should draw different sequences.")
+	}
+}
+
+func Test_SeedParsed(t *testing.T) {
+	if Parse("42") != 42 {
+		t.Error("Seed is parsed incorrectly.")
+	}
+	if Parse("") == 0 {
+		t.Error("Time based seed should be created if it is not set.")
+	}
+}
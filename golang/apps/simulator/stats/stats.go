@@ -0,0 +1,178 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+const (
+	// Latencies are tracked in microseconds between 1µs and 1 minute
+	minLatency        = 1
+	maxLatency        = int64(time.Minute / time.Microsecond)
+	significantDigits = 3
+)
+
+type key struct {
+	transport string
+	operation string
+}
+
+type entry struct {
+	count     int64
+	errors    int64
+	latencies *hdrhistogram.Histogram
+}
+
+// Aggregates the outcome of the simulated calls per transport & operation
+type Recorder struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	entries   map[key]*entry
+}
+
+type Summary struct {
+	Transport string  `json:"transport"`
+	Operation string  `json:"operation"`
+	Count     int64   `json:"count"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"errorRate"`
+	P50       float64 `json:"p50Ms"`
+	P90       float64 `json:"p90Ms"`
+	P99       float64 `json:"p99Ms"`
+	Max       float64 `json:"maxMs"`
+}
+
+type Report struct {
+	StartedAt  time.Time  `json:"startedAt"`
+	Uptime     string     `json:"uptime"`
+	Operations []*Summary `json:"operations"`
+}
+
+// Create a stats recorder instance
+func New() *Recorder {
+	return &Recorder{
+		startedAt: time.Now(),
+		entries:   map[key]*entry{},
+	}
+}
+
+// Records a call of the given operation. Calling it on a nil
+// recorder is a no-op.
+func (r *Recorder) Record(
+	transport string,
+	operation string,
+	latency time.Duration,
+	err error,
+) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := key{transport: transport, operation: operation}
+	e, ok := r.entries[k]
+	if !ok {
+		e = &entry{
+			latencies: hdrhistogram.New(minLatency, maxLatency, significantDigits),
+		}
+		r.entries[k] = e
+	}
+
+	e.count++
+	if err != nil {
+		e.errors++
+	}
+	e.latencies.RecordValue(clamp(latency.Microseconds()))
+}
+
+// Returns the aggregated stats sorted by transport & operation
+func (r *Recorder) Report() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &Report{
+		StartedAt:  r.startedAt,
+		Uptime:     time.Since(r.startedAt).Round(time.Second).String(),
+		Operations: make([]*Summary, 0, len(r.entries)),
+	}
+
+	for k, e := range r.entries {
+		report.Operations = append(report.Operations, &Summary{
+			Transport: k.transport,
+			Operation: k.operation,
+			Count:     e.count,
+			Errors:    e.errors,
+			ErrorRate: float64(e.errors) / float64(e.count),
+			P50:       toMillis(e.latencies.ValueAtQuantile(50)),
+			P90:       toMillis(e.latencies.ValueAtQuantile(90)),
+			P99:       toMillis(e.latencies.ValueAtQuantile(99)),
+			Max:       toMillis(e.latencies.Max()),
+		})
+	}
+
+	sort.Slice(report.Operations, func(i, j int) bool {
+		if report.Operations[i].Transport != report.Operations[j].Transport {
+			return report.Operations[i].Transport < report.Operations[j].Transport
+		}
+		return report.Operations[i].Operation < report.Operations[j].Operation
+	})
+
+	return report
+}
+
+// Stats handler
+func (r *Recorder) Stats(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(r.Report())
+}
+
+// Writes the aggregated stats as a table
+func (r *Recorder) WriteSummary(
+	w io.Writer,
+) {
+	report := r.Report()
+
+	fmt.Fprintf(w, "Simulation summary (uptime %s)\n", report.Uptime)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "TRANSPORT\tOPERATION\tCOUNT\tERRORS\tERROR RATE\tP50 (ms)\tP90 (ms)\tP99 (ms)\tMAX (ms)\t")
+	for _, s := range report.Operations {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f%%\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			s.Transport, s.Operation, s.Count, s.Errors, s.ErrorRate*100,
+			s.P50, s.P90, s.P99, s.Max,
+		)
+	}
+	tw.Flush()
+}
+
+func clamp(
+	value int64,
+) int64 {
+	if value < minLatency {
+		return minLatency
+	}
+	if value > maxLatency {
+		return maxLatency
+	}
+	return value
+}
+
+func toMillis(
+	micros int64,
+) float64 {
+	return float64(micros) / 1000
+}
@@ -0,0 +1,67 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_StatsAggregatedPerOperation(t *testing.T) {
+	r := New()
+	for i := 1; i <= 100; i++ {
+		var err error
+		if i%10 == 0 {
+			err = errors.New("failed")
+		}
+		r.Record("http", "GET", time.Duration(i)*time.Millisecond, err)
+	}
+	r.Record("kafka", "publish", time.Millisecond, nil)
+
+	report := r.Report()
+	if len(report.Operations) != 2 {
+		t.Fatalf("Expected 2 operations, got %d.", len(report.Operations))
+	}
+
+	get := report.Operations[0]
+	if get.Transport != "http" || get.Count != 100 || get.Errors != 10 {
+		t.Errorf("Unexpected summary %+v.", get)
+	}
+	if get.P50 < 49.5 || get.P50 > 50.5 {
+		t.Errorf("Expected p50 ~50ms, got %f.", get.P50)
+	}
+	if get.P99 < 98.5 || get.P99 > 99.5 {
+		t.Errorf("Expected p99 ~99ms, got %f.", get.P99)
+	}
+}
+
+func Test_StatsServedAsJson(t *testing.T) {
+	r := New()
+	r.Record("http", "GET", time.Millisecond, nil)
+
+	rec := httptest.NewRecorder()
+	r.Stats(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+	report := &Report{}
+	if err := json.NewDecoder(rec.Body).Decode(report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Operations) != 1 || report.Operations[0].Count != 1 {
+		t.Error("Stats are not served correctly.")
+	}
+
+	buf := &bytes.Buffer{}
+	r.WriteSummary(buf)
+	if !strings.Contains(buf.String(), "GET") {
+		t.Error("Summary table does not contain the operation.")
+	}
+}
+
+func Test_NilRecorderIgnored(t *testing.T) {
+	var r *Recorder
+	r.Record("http", "GET", time.Millisecond, nil)
+}
@@ -0,0 +1,263 @@
+package topics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/IBM/sarama"
+	semconv "github.com/utr1903/opentelemetry-playground/golang/apps/simulator/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SettingPartitions        = "partitions"
+	SettingReplicationFactor = "replicationFactor"
+
+	OperationList             = "list"
+	OperationCreate           = "create"
+	OperationCreatePartitions = "create_partitions"
+	OperationDescribeConfigs  = "describe_configs"
+)
+
+// Admin operations which the reconciliation needs. The sarama cluster
+// admin implements them.
+type Admin interface {
+	ListTopics() (map[string]sarama.TopicDetail, error)
+	CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error
+	CreatePartitions(topic string, count int32, assignment [][]int32, validateOnly bool) error
+	DescribeConfig(resource sarama.ConfigResource) ([]sarama.ConfigEntry, error)
+}
+
+// Difference between the spec & the actual state of a topic which
+// cannot be reconciled automatically
+type Drift struct {
+	Topic    string
+	Setting  string
+	Expected string
+	Actual   string
+}
+
+func (d *Drift) String() string {
+	return fmt.Sprintf("%s of topic %s is %s instead of %s", d.Setting, d.Topic, d.Actual, d.Expected)
+}
+
+// Brings the topics to the state of the specs as far as possible.
+// Missing topics are created & partitions are added to topics which have
+// less. Any other difference is returned as drift. Every admin operation
+// is traced & the failures of the topics are joined into the error.
+func Reconcile(
+	ctx context.Context,
+	admin Admin,
+	specs []*Spec,
+) (
+	[]*Drift,
+	error,
+) {
+	r := &reconciler{
+		admin:  admin,
+		tracer: otel.GetTracerProvider().Tracer(semconv.KafkaAdminName),
+	}
+
+	ctx, span := r.tracer.Start(
+		ctx,
+		"topics reconcile",
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			semconv.MessagingSystem.String("kafka"),
+			semconv.MessagingKafkaTopicCount.Int(len(specs)),
+		),
+	)
+	defer span.End()
+
+	var existing map[string]sarama.TopicDetail
+	err := r.operation(ctx, "", OperationList, func() error {
+		var err error
+		existing, err = admin.ListTopics()
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	drifts := []*Drift{}
+	errs := []error{}
+	for _, spec := range specs {
+		detail, ok := existing[spec.Name]
+		if !ok {
+			errs = append(errs, r.create(ctx, spec))
+			continue
+		}
+
+		topicDrifts, err := r.update(ctx, spec, &detail)
+		drifts = append(drifts, topicDrifts...)
+		errs = append(errs, err)
+	}
+
+	// Report the drifts on the reconciliation
+	for _, drift := range drifts {
+		span.AddEvent("topic drift", trace.WithAttributes(
+			semconv.MessagingDestinationName.String(drift.Topic),
+			semconv.MessagingKafkaTopicSetting.String(drift.Setting),
+			semconv.MessagingKafkaTopicSettingExpected.String(drift.Expected),
+			semconv.MessagingKafkaTopicSettingActual.String(drift.Actual),
+		))
+	}
+	span.SetAttributes(semconv.MessagingKafkaTopicDriftCount.Int(len(drifts)))
+
+	if err := errors.Join(errs...); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return drifts, err
+	}
+	return drifts, nil
+}
+
+type reconciler struct {
+	admin  Admin
+	tracer trace.Tracer
+}
+
+// Creates the missing topic with all of its settings
+func (r *reconciler) create(
+	ctx context.Context,
+	spec *Spec,
+) error {
+	configs := spec.configs()
+	entries := make(map[string]*string, len(configs))
+	for name, value := range configs {
+		value := value
+		entries[name] = &value
+	}
+
+	return r.operation(ctx, spec.Name, OperationCreate, func() error {
+		return r.admin.CreateTopic(spec.Name, &sarama.TopicDetail{
+			NumPartitions:     spec.Partitions,
+			ReplicationFactor: spec.ReplicationFactor,
+			ConfigEntries:     entries,
+		}, false)
+	})
+}
+
+// Adds the missing partitions of the existing topic & compares the rest
+// of its settings
+func (r *reconciler) update(
+	ctx context.Context,
+	spec *Spec,
+	detail *sarama.TopicDetail,
+) (
+	[]*Drift,
+	error,
+) {
+	drifts := []*Drift{}
+
+	// Partitions can only be added
+	if detail.NumPartitions < spec.Partitions {
+		err := r.operation(ctx, spec.Name, OperationCreatePartitions, func() error {
+			return r.admin.CreatePartitions(spec.Name, spec.Partitions, nil, false)
+		})
+		if err != nil {
+			return drifts, err
+		}
+	} else if detail.NumPartitions > spec.Partitions {
+		drifts = append(drifts, &Drift{
+			Topic:    spec.Name,
+			Setting:  SettingPartitions,
+			Expected: strconv.Itoa(int(spec.Partitions)),
+			Actual:   strconv.Itoa(int(detail.NumPartitions)),
+		})
+	}
+
+	if detail.ReplicationFactor != spec.ReplicationFactor {
+		drifts = append(drifts, &Drift{
+			Topic:    spec.Name,
+			Setting:  SettingReplicationFactor,
+			Expected: strconv.Itoa(int(spec.ReplicationFactor)),
+			Actual:   strconv.Itoa(int(detail.ReplicationFactor)),
+		})
+	}
+
+	configs := spec.configs()
+	if len(configs) == 0 {
+		return drifts, nil
+	}
+
+	// Compare the configs in a fixed order
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var entries []sarama.ConfigEntry
+	err := r.operation(ctx, spec.Name, OperationDescribeConfigs, func() error {
+		var err error
+		entries, err = r.admin.DescribeConfig(sarama.ConfigResource{
+			Type:        sarama.TopicResource,
+			Name:        spec.Name,
+			ConfigNames: names,
+		})
+		return err
+	})
+	if err != nil {
+		return drifts, err
+	}
+
+	actual := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		actual[entry.Name] = entry.Value
+	}
+	for _, name := range names {
+		if actual[name] != configs[name] {
+			drifts = append(drifts, &Drift{
+				Topic:    spec.Name,
+				Setting:  name,
+				Expected: configs[name],
+				Actual:   actual[name],
+			})
+		}
+	}
+
+	return drifts, nil
+}
+
+// Runs the admin operation on the topic within its own span
+func (r *reconciler) operation(
+	ctx context.Context,
+	topic string,
+	operation string,
+	run func() error,
+) error {
+	name := "topics " + operation
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystem.String("kafka"),
+		semconv.MessagingKafkaAdminOperation.String(operation),
+	}
+	if topic != "" {
+		name = topic + " " + operation
+		attrs = append(attrs, semconv.MessagingDestinationName.String(topic))
+	}
+
+	_, span := r.tracer.Start(
+		ctx,
+		name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+
+	if err := run(); err != nil {
+		err = fmt.Errorf("%s failed: %w", name, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
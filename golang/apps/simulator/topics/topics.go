@@ -0,0 +1,132 @@
+package topics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/utr1903/opentelemetry-playground/golang/apps/simulator/duration"
+)
+
+const (
+	ConfigRetention     = "retention.ms"
+	ConfigCleanupPolicy = "cleanup.policy"
+)
+
+// Desired state of a topic
+type Spec struct {
+	Name              string `json:"name"`
+	Partitions        int32  `json:"partitions,omitempty"`
+	ReplicationFactor int16  `json:"replicationFactor,omitempty"`
+
+	// Shorthands of the retention.ms & cleanup.policy configs
+	Retention     duration.Duration `json:"retention,omitempty"`
+	CleanupPolicy string            `json:"cleanupPolicy,omitempty"`
+
+	// Any other topic configs
+	Configs map[string]string `json:"configs,omitempty"`
+}
+
+type Topics struct {
+	Topics []*Spec `json:"topics"`
+}
+
+// Loads the topic specs from the given JSON file
+func Load(
+	path string,
+) (
+	[]*Spec,
+	error,
+) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(content)
+}
+
+// Parses the topic specs out of the given JSON content
+func Parse(
+	content []byte,
+) (
+	[]*Spec,
+	error,
+) {
+	t := &Topics{}
+	if err := json.Unmarshal(content, t); err != nil {
+		return nil, err
+	}
+
+	if err := Validate(t.Topics); err != nil {
+		return nil, err
+	}
+
+	return t.Topics, nil
+}
+
+// Checks the specs and fills up the default values
+func Validate(
+	specs []*Spec,
+) error {
+	names := map[string]bool{}
+	for i, spec := range specs {
+		if spec.Name == "" {
+			return fmt.Errorf("topic %d has no name", i)
+		}
+		if names[spec.Name] {
+			return fmt.Errorf("topic %q is defined twice", spec.Name)
+		}
+		names[spec.Name] = true
+
+		if spec.Partitions < 0 || spec.ReplicationFactor < 0 || spec.Retention < 0 {
+			return fmt.Errorf("topic %q has negative settings", spec.Name)
+		}
+		if spec.Partitions == 0 {
+			spec.Partitions = 1
+		}
+		if spec.ReplicationFactor == 0 {
+			spec.ReplicationFactor = 1
+		}
+
+		if _, ok := spec.Configs[ConfigRetention]; ok && spec.Retention > 0 {
+			return errors.New("retention of topic " + spec.Name + " is given twice")
+		}
+		if _, ok := spec.Configs[ConfigCleanupPolicy]; ok && spec.CleanupPolicy != "" {
+			return errors.New("cleanup policy of topic " + spec.Name + " is given twice")
+		}
+	}
+	return nil
+}
+
+// Returns the specs with the given one added unless a spec of the same
+// topic is already there
+func WithDefault(
+	specs []*Spec,
+	spec *Spec,
+) []*Spec {
+	for _, s := range specs {
+		if s.Name == spec.Name {
+			return specs
+		}
+	}
+	return append(specs, spec)
+}
+
+// Returns all configs of the topic including the shorthands
+func (s *Spec) configs() map[string]string {
+	configs := make(map[string]string, len(s.Configs)+2)
+	for name, value := range s.Configs {
+		configs[name] = value
+	}
+	if s.Retention > 0 {
+		configs[ConfigRetention] = strconv.FormatInt(int64(time.Duration(s.Retention)/time.Millisecond), 10)
+	}
+	if s.CleanupPolicy != "" {
+		configs[ConfigCleanupPolicy] = s.CleanupPolicy
+	}
+	return configs
+}
@@ -0,0 +1,150 @@
+package topics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeAdmin struct {
+	topics     map[string]sarama.TopicDetail
+	configs    map[string]map[string]string
+	created    map[string]*sarama.TopicDetail
+	partitions map[string]int32
+	createErr  error
+}
+
+func (a *fakeAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	return a.topics, nil
+}
+
+func (a *fakeAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, _ bool) error {
+	if a.createErr != nil {
+		return a.createErr
+	}
+	a.created[topic] = detail
+	return nil
+}
+
+func (a *fakeAdmin) CreatePartitions(topic string, count int32, _ [][]int32, _ bool) error {
+	a.partitions[topic] = count
+	return nil
+}
+
+func (a *fakeAdmin) DescribeConfig(resource sarama.ConfigResource) ([]sarama.ConfigEntry, error) {
+	entries := []sarama.ConfigEntry{}
+	for _, name := range resource.ConfigNames {
+		entries = append(entries, sarama.ConfigEntry{Name: name, Value: a.configs[resource.Name][name]})
+	}
+	return entries, nil
+}
+
+func newFakeAdmin() *fakeAdmin {
+	return &fakeAdmin{
+		topics: map[string]sarama.TopicDetail{
+			"otel": {NumPartitions: 1, ReplicationFactor: 1},
+			"dlq":  {NumPartitions: 3, ReplicationFactor: 1},
+		},
+		configs: map[string]map[string]string{
+			"dlq": {ConfigRetention: "604800000", ConfigCleanupPolicy: "compact"},
+		},
+		created:    map[string]*sarama.TopicDetail{},
+		partitions: map[string]int32{},
+	}
+}
+
+func Test_SpecsParsedWithDefaults(t *testing.T) {
+	specs, err := Parse([]byte(`{"topics": [
+		{"name": "otel"},
+		{"name": "dlq", "retention": "168h", "cleanupPolicy": "delete", "configs": {"min.insync.replicas": "1"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if specs[0].Partitions != 1 || specs[0].ReplicationFactor != 1 {
+		t.Errorf("Expected 1 partition & replica by default, got %+v.", specs[0])
+	}
+	configs := specs[1].configs()
+	if configs[ConfigRetention] != "604800000" || configs[ConfigCleanupPolicy] != "delete" || configs["min.insync.replicas"] != "1" {
+		t.Errorf("Unexpected configs %v.", configs)
+	}
+
+	if _, err := Parse([]byte(`{"topics": [{"name": "otel"}, {"name": "otel"}]}`)); err == nil {
+		t.Error("Duplicate topics should be rejected.")
+	}
+	if _, err := Parse([]byte(`{"topics": [{"name": "otel", "retention": "1h", "configs": {"retention.ms": "1"}}]}`)); err == nil {
+		t.Error("Retention given twice should be rejected.")
+	}
+}
+
+func Test_TopicsReconciled(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	admin := newFakeAdmin()
+	specs, _ := Parse([]byte(`{"topics": [
+		{"name": "otel", "partitions": 3},
+		{"name": "dlq", "partitions": 1, "retention": "168h", "cleanupPolicy": "delete"},
+		{"name": "retry-5s", "partitions": 2, "cleanupPolicy": "delete"}
+	]}`))
+
+	drifts, err := Reconcile(context.Background(), admin, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if admin.partitions["otel"] != 3 {
+		t.Error("Partitions of otel should be increased to 3.")
+	}
+	created, ok := admin.created["retry-5s"]
+	if !ok || created.NumPartitions != 2 || *created.ConfigEntries[ConfigCleanupPolicy] != "delete" {
+		t.Error("Missing topic should be created with its settings.")
+	}
+
+	// Partitions cannot be decreased & configs are only reported
+	if len(drifts) != 2 ||
+		drifts[0].Setting != SettingPartitions ||
+		drifts[1].Setting != ConfigCleanupPolicy || drifts[1].Actual != "compact" {
+		t.Errorf("Unexpected drifts %v.", drifts)
+	}
+
+	names := map[string]bool{}
+	for _, span := range sr.Ended() {
+		names[span.Name()] = true
+	}
+	for _, name := range []string{"topics reconcile", "topics list", "otel create_partitions", "dlq describe_configs", "retry-5s create"} {
+		if !names[name] {
+			t.Errorf("Expected %q span.", name)
+		}
+	}
+}
+
+func Test_FailedTopicDoesNotStopOthers(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	admin := newFakeAdmin()
+	admin.createErr = sarama.ErrTopicAuthorizationFailed
+	specs, _ := Parse([]byte(`{"topics": [{"name": "new"}, {"name": "otel", "partitions": 2}]}`))
+
+	_, err := Reconcile(context.Background(), admin, specs)
+	if !errors.Is(err, sarama.ErrTopicAuthorizationFailed) {
+		t.Fatalf("Expected the failure of the topic, got %v.", err)
+	}
+	if admin.partitions["otel"] != 2 {
+		t.Error("Other topics should still be reconciled.")
+	}
+
+	for _, span := range sr.Ended() {
+		if span.Name() == "new create" && span.Status().Code != codes.Error {
+			t.Error("Failed admin operation should have error status.")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package traffic
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// A single simulated HTTP call or Kafka message
+type Entry struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Transport string            `json:"transport"`
+	Operation string            `json:"operation"`
+	User      string            `json:"user"`
+	Tier      string            `json:"tier,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	Key       string            `json:"key,omitempty"`
+	Payload   string            `json:"payload,omitempty"`
+	Result    string            `json:"result"`
+	Error     string            `json:"error,omitempty"`
+	Duration  float64           `json:"durationMs"`
+}
+
+// Writes every simulated call as a JSON line into a file
+type Recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// Create a traffic recorder which writes into the given file
+func NewRecorder(
+	path string,
+) (
+	*Recorder,
+	error,
+) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// Records the given call. Calling it on a nil recorder is a no-op.
+func (r *Recorder) Record(
+	entry *Entry,
+	err error,
+) {
+	if r == nil {
+		return
+	}
+
+	entry.Result = ResultSuccess
+	if err != nil {
+		entry.Result = ResultFailure
+		entry.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.encoder.Encode(entry)
+}
+
+// Flushes & closes the recording file
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.file.Sync(); err != nil {
+		return err
+	}
+	return r.file.Close()
+}
+
+// Loads the recorded calls from the given JSONL file in the order
+// they were started
+func Load(
+	path string,
+) (
+	[]*Entry,
+	error,
+) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []*Entry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Calls are recorded when they finish so sort them by their start
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	return entries, nil
+}
+
+// Returns the entries of the given transport
+func Filter(
+	entries []*Entry,
+	transport string,
+) []*Entry {
+	filtered := []*Entry{}
+	for _, entry := range entries {
+		if entry.Transport == transport {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// Re-issues the given entries with their original timing relative to
+// the origin. The speed accelerates (>1) or slows down (<1) the
+// replay. Every entry is played concurrently like it was originally
+// and the replay returns when all of them are finished.
+func Replay(
+	entries []*Entry,
+	origin time.Time,
+	speed float64,
+	play func(*Entry),
+) {
+	if speed <= 0 {
+		speed = 1
+	}
+
+	startedAt := time.Now()
+	wg := sync.WaitGroup{}
+	for _, entry := range entries {
+		offset := time.Duration(float64(entry.Timestamp.Sub(origin)) / speed)
+		time.Sleep(time.Until(startedAt.Add(offset)))
+
+		wg.Add(1)
+		go func(entry *Entry) {
+			defer wg.Done()
+			play(entry)
+		}(entry)
+	}
+	wg.Wait()
+}
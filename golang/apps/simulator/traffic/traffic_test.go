@@ -0,0 +1,93 @@
+package traffic
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_RecordedTrafficLoaded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startedAt := time.Now()
+	recorder.Record(&Entry{
+		Timestamp: startedAt.Add(time.Second),
+		Transport: "kafka",
+		Operation: "publish",
+		User:      "elon",
+		Payload:   "elon",
+	}, nil)
+	recorder.Record(&Entry{
+		Timestamp: startedAt,
+		Transport: "http",
+		Operation: "GET",
+		User:      "jeff",
+		Params:    map[string]string{"databaseConnectionError": "true"},
+	}, errors.New("call to donald returned not ok status"))
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d.", len(entries))
+	}
+
+	http := entries[0]
+	if http.Transport != "http" || http.Result != ResultFailure || http.Params["databaseConnectionError"] != "true" {
+		t.Errorf("Entries should be sorted by their start & keep their params: %+v", http)
+	}
+	if http.Error != "call to donald returned not ok status" {
+		t.Errorf("Error is not recorded: %q", http.Error)
+	}
+
+	kafka := entries[1]
+	if kafka.Result != ResultSuccess || kafka.Payload != "elon" {
+		t.Errorf("Message is not recorded correctly: %+v", kafka)
+	}
+
+	if len(Filter(entries, "kafka")) != 1 {
+		t.Error("Entries are not filtered by transport.")
+	}
+}
+
+func Test_NilRecorderIgnored(t *testing.T) {
+	var recorder *Recorder
+	recorder.Record(&Entry{}, nil)
+	if err := recorder.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_ReplayAccelerated(t *testing.T) {
+	origin := time.Now()
+	entries := []*Entry{
+		{Timestamp: origin, User: "first"},
+		{Timestamp: origin.Add(200 * time.Millisecond), User: "second"},
+	}
+
+	mu := sync.Mutex{}
+	played := map[string]time.Duration{}
+	startedAt := time.Now()
+	Replay(entries, origin, 4, func(entry *Entry) {
+		mu.Lock()
+		defer mu.Unlock()
+		played[entry.User] = time.Since(startedAt)
+	})
+
+	if len(played) != 2 {
+		t.Fatalf("Expected 2 replayed entries, got %d.", len(played))
+	}
+	if played["second"] < 50*time.Millisecond || played["second"] > 150*time.Millisecond {
+		t.Errorf("Second entry should be replayed after ~50ms, got %s.", played["second"])
+	}
+}